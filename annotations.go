@@ -0,0 +1,145 @@
+package frank
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// An Annotation marks a moment, such as a deploy, repair or incident, on
+// the heatmaps of a cluster, or only of one node or table of it.
+type Annotation struct {
+	ID          int64    `json:"id"`
+	TimestampMS int64    `json:"timestamp_ms"`
+	Cluster     string   `json:"cluster"`
+	Node        string   `json:"node,omitempty"`
+	Table       string   `json:"table,omitempty"`
+	Text        string   `json:"text"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// Applies reports whether the annotation belongs on the heatmaps of node
+// and table (keyspace.columnfamily) of cluster. An empty node or table
+// matches annotations of any.
+func (a Annotation) Applies(cluster, node, table string) bool {
+	return a.Cluster == cluster &&
+		(node == "" || a.Node == "" || a.Node == node) &&
+		(table == "" || a.Table == "" || a.Table == table)
+}
+
+// AddAnnotation stores a copy of a with a new ID and returns it.
+func (u *Utility) AddAnnotation(a Annotation) (Annotation, error) {
+	if a.Cluster == "" || strings.TrimSpace(a.Text) == "" || a.TimestampMS <= 0 {
+		return a, fmt.Errorf("An annotation needs a cluster, text and timestamp")
+	}
+	if strings.Contains(a.Cluster+a.Node+a.Table, ":") {
+		return a, fmt.Errorf("Cluster, node and table may not contain ':'")
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.lastAnnotation++
+	a.ID = u.lastAnnotation
+	u.annotations = append(u.annotations, a)
+	return a, nil
+}
+
+// Annotations returns the annotations that apply to node and table of
+// cluster between start and end (unix milliseconds, inclusive), oldest
+// first. An empty cluster returns those of every cluster.
+func (u *Utility) Annotations(cluster, node, table string, start, end int64) []Annotation {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	ret := make([]Annotation, 0)
+	for _, a := range u.annotations {
+		if a.TimestampMS < start || a.TimestampMS > end {
+			continue
+		}
+		if cluster == "" || a.Applies(cluster, node, table) {
+			ret = append(ret, a)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].TimestampMS < ret[j].TimestampMS })
+	return ret
+}
+
+func (u *Utility) DeleteAnnotation(id int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for x, a := range u.annotations {
+		if a.ID == id {
+			u.annotations = append(u.annotations[:x], u.annotations[x+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unable to find annotation %d", id)
+}
+
+// Annotations, SLOs, dashboards and node details are saved as JSON files
+// next to the save file, which only holds meters.
+func (u *Utility) sidecarFile(suffix string) string {
+	return u.Config.SaveFile + "." + suffix
+}
+
+func (u *Utility) saveSidecar(suffix string, v interface{}) error {
+	u.mu.RLock()
+	failed := u.unloaded[suffix]
+	data, err := json.MarshalIndent(v, "", "  ")
+	u.mu.RUnlock()
+	if failed != nil {
+		return fmt.Errorf("Not saving %s, which failed to load: %s", u.sidecarFile(suffix), failed)
+	}
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(u.sidecarFile(suffix), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// loadSidecar decodes a sidecar file into v, leaving v alone if there is
+// none. A sidecar that cannot be read or parsed is not saved over until a
+// later Load succeeds.
+func (u *Utility) loadSidecar(suffix string, v interface{}) error {
+	data, err := ioutil.ReadFile(u.sidecarFile(suffix))
+	if err == nil {
+		if err = json.Unmarshal(data, v); err != nil {
+			err = fmt.Errorf("Unable to parse %s: %s", u.sidecarFile(suffix), err)
+		}
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err != nil {
+		u.unloaded[suffix] = err
+		return err
+	}
+	delete(u.unloaded, suffix)
+	return nil
+}
+
+func (u *Utility) saveAnnotations() error {
+	return u.saveSidecar("annotations", &u.annotations)
+}
+
+func (u *Utility) loadAnnotations() error {
+	var loaded []Annotation
+	if err := u.loadSidecar("annotations", &loaded); err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.annotations = loaded
+	u.lastAnnotation = 0
+	for _, a := range loaded {
+		if a.ID > u.lastAnnotation {
+			u.lastAnnotation = a.ID
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package frank
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	c := DefaultUtilityConfig()
+	c.SaveFile = filepath.Join(t.TempDir(), "frank.sav")
+	u := NewUtilityWithConfig(c)
+	for _, a := range []Annotation{
+		{TimestampMS: 3000, Cluster: "Prod", Text: "deploy v2.3"},
+		{TimestampMS: 1000, Cluster: "Prod", Node: "10.0.0.1", Text: "node restart"},
+		{TimestampMS: 2000, Cluster: "Prod", Table: "Space1.Test1", Text: "repair started", Tags: []string{"repair"}},
+		{TimestampMS: 2000, Cluster: "Test", Text: "load test"},
+	} {
+		if _, err := u.AddAnnotation(a); err != nil {
+			t.Fatalf("AddAnnotation produced error: %s", err)
+		}
+	}
+	if _, err := u.AddAnnotation(Annotation{TimestampMS: 1000, Cluster: "Prod"}); err == nil {
+		t.Errorf("An annotation without text should produce an error")
+	}
+
+	got := u.Annotations("Prod", "10.0.0.2", "Space1.Test1", 0, 5000)
+	if len(got) != 2 || got[0].Text != "repair started" || got[1].Text != "deploy v2.3" {
+		t.Errorf("Invalid annotations for another node : %v", got)
+	}
+	if got := u.Annotations("Prod", "", "", 1000, 2000); len(got) != 2 || got[0].ID != 2 {
+		t.Errorf("Invalid annotations in range : %v", got)
+	}
+	if got := u.Annotations("", "", "", 0, 5000); len(got) != 4 {
+		t.Errorf("Invalid annotations of every cluster : %v", got)
+	}
+
+	if err := u.DeleteAnnotation(1); err != nil {
+		t.Errorf("DeleteAnnotation produced error: %s", err)
+	}
+	if err := u.DeleteAnnotation(1); err == nil {
+		t.Errorf("Deleting a missing annotation should produce an error")
+	}
+	if err := u.Save(); err != nil {
+		t.Fatalf("Save produced error: %s", err)
+	}
+	u2 := NewUtilityWithConfig(c)
+	if err := u2.Load(); err != nil {
+		t.Fatalf("Load produced error: %s", err)
+	}
+	if got := u2.Annotations("", "", "", 0, 5000); len(got) != 3 || got[1].Tags[0] != "repair" {
+		t.Errorf("Invalid annotations after Load : %v", got)
+	}
+	if a, _ := u2.AddAnnotation(Annotation{TimestampMS: 4000, Cluster: "Prod", Text: "incident"}); a.ID != 5 {
+		t.Errorf("Invalid ID after Load : %d, should be 5", a.ID)
+	}
+}
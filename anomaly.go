@@ -0,0 +1,145 @@
+package frank
+
+import (
+	"fmt"
+	"math"
+)
+
+// A Distance compares two histograms over Labels as distributions; their
+// total counts do not matter.
+type Distance func(p, q []float64) float64
+
+var Distances = map[string]Distance{
+	"kl":  KLDivergence,
+	"emd": EarthMovers,
+}
+
+// DefaultAnomalyThresholds are distances that stand out for latency
+// histograms: a KL divergence of 1 nat, or half the events moving three
+// buckets (about 70% slower).
+var DefaultAnomalyThresholds = map[string]float64{
+	"kl":  1,
+	"emd": 1.5,
+}
+
+func normalize(data []float64) []float64 {
+	total := Count(data)
+	ret := make([]float64, len(data))
+	for x, v := range data {
+		if total > 0 && v > 0 {
+			ret[x] = v / total
+		}
+	}
+	return ret
+}
+
+// KLDivergence returns the Kullback-Leibler divergence of p from the
+// baseline q in nats. Both are smoothed so that buckets empty in q do not
+// make it infinite.
+func KLDivergence(p, q []float64) float64 {
+	const epsilon = 1e-4
+	pn, qn := normalize(p), normalize(q)
+	smooth := 1 + epsilon*float64(len(pn))
+	ret := 0.0
+	for x := range pn {
+		pv := (pn[x] + epsilon) / smooth
+		qv := (qn[x] + epsilon) / smooth
+		ret += pv * math.Log(pv/qv)
+	}
+	return ret
+}
+
+// EarthMovers returns the earth mover's distance between p and q in
+// buckets: the share of events times how many buckets they have to move.
+// Buckets grow by about 20%, so this measures relative latency change.
+func EarthMovers(p, q []float64) float64 {
+	pn, qn := normalize(p), normalize(q)
+	ret, pc, qc := 0.0, 0.0, 0.0
+	for x := range pn {
+		pc += pn[x]
+		qc += qn[x]
+		ret += math.Abs(pc - qc)
+	}
+	return ret
+}
+
+// EWMABaseline returns, for each of the aligned and diffed samples, the
+// exponentially weighted average of the distributions before it, alpha
+// being the weight of the newest. Empty intervals are skipped, and the
+// baseline of the first sample is empty.
+func EWMABaseline(samples []Sample, alpha float64) [][]float64 {
+	ret := make([][]float64, len(samples))
+	cur := make([]float64, len(Labels))
+	started := false
+	for x, s := range samples {
+		ret[x] = append([]float64{}, cur...)
+		if Count(s.Data) <= 0 {
+			continue
+		}
+		n := normalize(s.Data)
+		for y := range cur {
+			if started {
+				cur[y] = alpha*n[y] + (1-alpha)*cur[y]
+			} else {
+				cur[y] = n[y]
+			}
+		}
+		started = true
+	}
+	return ret
+}
+
+// SumBaseline adds up series lined up with the samples being checked, such
+// as the same hours of the previous days, into one baseline per interval.
+func SumBaseline(series [][]Sample) [][]float64 {
+	if len(series) == 0 {
+		return nil
+	}
+	ret := make([][]float64, len(series[0]))
+	for x := range ret {
+		ret[x] = make([]float64, len(Labels))
+		for _, s := range series {
+			if x >= len(s) {
+				continue
+			}
+			for y, v := range s[x].Data {
+				if v > 0 {
+					ret[x][y] += v
+				}
+			}
+		}
+	}
+	return ret
+}
+
+type Anomaly struct {
+	TimestampMS int64   `json:"timestamp_ms"`
+	Count       float64 `json:"count"`
+	Score       float64 `json:"score"`
+	Scored      bool    `json:"scored"`
+	Anomalous   bool    `json:"anomalous"`
+}
+
+// DetectAnomalies scores every sample by its distance from its baseline.
+// Intervals with fewer than minCount events, or without a baseline, are
+// not scored.
+func DetectAnomalies(samples []Sample, baseline [][]float64, distance string, threshold, minCount float64) ([]Anomaly, error) {
+	dist, ok := Distances[distance]
+	if !ok {
+		return nil, fmt.Errorf("Unknown distance %q", distance)
+	}
+	if len(baseline) != len(samples) {
+		return nil, fmt.Errorf("Baseline has %d intervals, expected %d", len(baseline), len(samples))
+	}
+	ret := make([]Anomaly, len(samples))
+	for x, s := range samples {
+		a := Anomaly{TimestampMS: s.TimestampMS, Count: Count(s.Data)}
+		if a.Count > 0 && a.Count >= minCount && Count(baseline[x]) > 0 {
+			a.Score = dist(s.Data, baseline[x])
+			a.Scored = true
+			a.Anomalous = a.Score > threshold
+		}
+		ret[x] = a
+	}
+	return ret, nil
+}
@@ -0,0 +1,65 @@
+package frank
+
+import (
+	"math"
+	"testing"
+)
+
+func histogram(counts map[int]float64) []float64 {
+	ret := make([]float64, len(Labels))
+	for x, v := range counts {
+		ret[x] = v
+	}
+	return ret
+}
+
+func TestDistances(t *testing.T) {
+	p := histogram(map[int]float64{30: 90, 31: 10})
+	if d := KLDivergence(p, histogram(map[int]float64{30: 9, 31: 1})); math.Abs(d) > 1e-9 {
+		t.Errorf("KL divergence of the same distribution is %f, should be 0", d)
+	}
+	if d := KLDivergence(p, histogram(map[int]float64{40: 1})); d < 5 || math.IsInf(d, 0) {
+		t.Errorf("KL divergence of disjoint distributions is %f, should be large and finite", d)
+	}
+	if d := EarthMovers(p, histogram(map[int]float64{33: 90, 34: 10})); math.Abs(d-3) > 1e-9 {
+		t.Errorf("Earth mover's distance of a 3 bucket shift is %f, should be 3", d)
+	}
+	if d := EarthMovers(p, p); d != 0 {
+		t.Errorf("Earth mover's distance of the same histogram is %f, should be 0", d)
+	}
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	samples := make([]Sample, 30)
+	for x := range samples {
+		samples[x] = Sample{int64(x) * 5000, histogram(map[int]float64{30: 90, 31: 10})}
+	}
+	samples[20].Data = histogram(map[int]float64{36: 80, 37: 20})
+	samples[25].Data = histogram(map[int]float64{36: 1})
+	samples[26].Data = make([]float64, len(Labels))
+
+	baseline := EWMABaseline(samples, 0.1)
+	if Count(baseline[0]) != 0 || math.Abs(Count(baseline[1])-1) > 1e-9 {
+		t.Errorf("Invalid baseline starts : %f, %f", Count(baseline[0]), Count(baseline[1]))
+	}
+	for _, distance := range []string{"kl", "emd"} {
+		anomalies, err := DetectAnomalies(samples, baseline, distance, DefaultAnomalyThresholds[distance], 10)
+		if err != nil {
+			t.Fatalf("DetectAnomalies(%s) produced error: %s", distance, err)
+		}
+		for x, a := range anomalies {
+			scored := x != 0 && x != 25 && x != 26
+			if a.Scored != scored || a.Anomalous != (x == 20) {
+				t.Errorf("%s: interval %d : %+v", distance, x, a)
+			}
+		}
+	}
+	if _, err := DetectAnomalies(samples, baseline, "chi2", 1, 0); err == nil {
+		t.Errorf("Expected an error for an unknown distance")
+	}
+
+	daily := SumBaseline([][]Sample{samples[:10], samples[10:20]})
+	if len(daily) != 10 || daily[3][30] != 180 {
+		t.Errorf("Invalid summed baseline : %d intervals, %v", len(daily), daily[3][29:32])
+	}
+}
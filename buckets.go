@@ -0,0 +1,124 @@
+package frank
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BucketOptions coarsen and crop the Labels buckets of aligned samples.
+// Min and Max, in microseconds, keep only the buckets holding latencies
+// between them; Trim further drops the empty buckets at either end. The
+// buckets left are merged into at most Rows rows of adjacent buckets, or
+// into rows ending at the buckets holding each of Bounds.
+type BucketOptions struct {
+	Min    float64
+	Max    float64
+	Trim   bool
+	Rows   int
+	Bounds []float64
+}
+
+// rows returns the first Labels bucket kept and the last bucket of each
+// row.
+func (o BucketOptions) rows(samples []Sample) (int, []int, error) {
+	if o.Min < 0 || o.Rows < 0 || (o.Max > 0 && o.Max < o.Min) {
+		return 0, nil, fmt.Errorf("min must be at most max and rows not negative")
+	}
+	if o.Rows > 0 && len(o.Bounds) > 0 {
+		return 0, nil, fmt.Errorf("Set one of rows or bounds")
+	}
+	lo, hi := LabelIndex(o.Min), len(Labels)-1
+	if o.Max > 0 {
+		hi = LabelIndex(o.Max)
+	}
+	if o.Trim {
+		first, last := hi+1, lo-1
+		for _, s := range samples {
+			for y := lo; y <= hi && y < len(s.Data); y++ {
+				if s.Data[y] != 0 {
+					if y < first {
+						first = y
+					}
+					if y > last {
+						last = y
+					}
+				}
+			}
+		}
+		if last < first {
+			return lo, []int{}, nil
+		}
+		lo, hi = first, last
+	}
+	ends := make([]int, 0)
+	switch {
+	case len(o.Bounds) > 0:
+		bounds := append([]float64{}, o.Bounds...)
+		sort.Float64s(bounds)
+		for _, b := range bounds {
+			end := LabelIndex(b)
+			if end >= lo && end <= hi && (len(ends) == 0 || end > ends[len(ends)-1]) {
+				ends = append(ends, end)
+			}
+		}
+		if len(ends) == 0 || ends[len(ends)-1] < hi {
+			ends = append(ends, hi)
+		}
+	default:
+		group := 1
+		if o.Rows > 0 {
+			group = (hi - lo + o.Rows) / o.Rows
+		}
+		for end := lo + group - 1; ; end += group {
+			if end >= hi {
+				ends = append(ends, hi)
+				break
+			}
+			ends = append(ends, end)
+		}
+	}
+	return lo, ends, nil
+}
+
+// Coarsen merges and crops the buckets of aligned samples as opts says,
+// returning samples with one value per row, fastest first, and the upper
+// bound from Labels of each row. Without options it returns a copy.
+func Coarsen(samples []Sample, opts BucketOptions) ([]Sample, []float64, error) {
+	start, ends, err := opts.rows(samples)
+	if err != nil {
+		return nil, nil, err
+	}
+	bounds := make([]float64, len(ends))
+	for r, end := range ends {
+		bounds[r] = Labels[end]
+	}
+	ret := make([]Sample, len(samples))
+	for x, s := range samples {
+		ret[x] = Sample{TimestampMS: s.TimestampMS, Data: make([]float64, len(ends))}
+		y := start
+		for r, end := range ends {
+			for ; y <= end; y++ {
+				if y < len(s.Data) {
+					ret[x].Data[r] += s.Data[y]
+				}
+			}
+		}
+	}
+	return ret, bounds, nil
+}
+
+// ParseLatencies parses a comma separated list of durations, such as
+// 1ms,10ms,100ms,1s, into microseconds like Labels.
+func ParseLatencies(v string) ([]float64, error) {
+	ret := make([]float64, 0)
+	for _, part := range strings.Split(v, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("Invalid latency %q", part)
+		}
+		ret = append(ret, float64(d/time.Microsecond))
+	}
+	return ret, nil
+}
@@ -0,0 +1,65 @@
+package frank
+
+import (
+	"math"
+	"testing"
+)
+
+func bucketSamples() []Sample {
+	ret := make([]Sample, 2)
+	for x := range ret {
+		ret[x] = Sample{TimestampMS: int64(x) * 1000, Data: make([]float64, len(Labels))}
+		ret[x].Data[10] = 1
+		ret[x].Data[34] = 2
+		ret[x].Data[50] = 4
+		ret[x].Data[90] = 8
+	}
+	return ret
+}
+
+func TestCoarsen(t *testing.T) {
+	same, bounds, err := Coarsen(bucketSamples(), BucketOptions{})
+	if err != nil || len(bounds) != len(Labels) || same[1].Data[50] != 4 || same[1].TimestampMS != 1000 {
+		t.Errorf("Invalid copy : %v, %v", bounds, err)
+	}
+
+	named, bounds, _ := Coarsen(bucketSamples(), BucketOptions{Bounds: []float64{10000, 1000}})
+	if len(bounds) != 3 || bounds[0] != 1109 || bounds[1] != Labels[LabelIndex(10000)] || bounds[2] != math.MaxFloat64 {
+		t.Errorf("Invalid named bounds : %v", bounds)
+	}
+	if d := named[0].Data; d[0] != 3 || d[1] != 0 || d[2] != 12 {
+		t.Errorf("Invalid named rows : %v", d)
+	}
+
+	// Trimmed to buckets 10 to 90, nine buckets a row.
+	rows, bounds, _ := Coarsen(bucketSamples(), BucketOptions{Rows: 10, Trim: true})
+	if len(bounds) != 9 || bounds[0] != Labels[18] || rows[0].Data[0] != 1 || rows[0].Data[8] != 8 || Count(rows[0].Data) != 15 {
+		t.Errorf("Invalid rows : %v, %v", bounds, rows[0].Data)
+	}
+
+	cropped, bounds, _ := Coarsen(bucketSamples(), BucketOptions{Min: 1000, Max: 100000})
+	if len(bounds) != 26 || bounds[0] != 1109 || Count(cropped[0].Data) != 6 {
+		t.Errorf("Invalid crop : %v, %v", bounds, cropped[0].Data)
+	}
+
+	empty, bounds, _ := Coarsen(bucketSamples(), BucketOptions{Min: 50, Max: 500, Trim: true})
+	if len(bounds) != 0 || len(empty[0].Data) != 0 {
+		t.Errorf("Invalid trim of an empty range : %v", bounds)
+	}
+
+	for _, o := range []BucketOptions{{Min: 10, Max: 5}, {Rows: 3, Bounds: []float64{1000}}, {Rows: -1}} {
+		if _, _, err := Coarsen(bucketSamples(), o); err == nil {
+			t.Errorf("%+v should produce an error", o)
+		}
+	}
+}
+
+func TestParseLatencies(t *testing.T) {
+	got, err := ParseLatencies("1ms, 10ms,1s")
+	if err != nil || len(got) != 3 || got[0] != 1000 || got[2] != 1e6 {
+		t.Errorf("Invalid latencies : %v, %v", got, err)
+	}
+	if _, err := ParseLatencies("1ms,fast"); err == nil {
+		t.Errorf("An invalid latency should produce an error")
+	}
+}
@@ -0,0 +1,59 @@
+package frank
+
+import (
+	"sort"
+)
+
+// A Contribution is how many of the events in a heatmap cell, or a range
+// of them, came from one node (or column family, or meter). Share is its
+// part of the cell's events and Total all of its events over the same
+// intervals, in every bucket.
+type Contribution struct {
+	Key   string  `json:"key"`
+	Count float64 `json:"count"`
+	Share float64 `json:"share"`
+	Total float64 `json:"total"`
+}
+
+// Contributions adds up the aligned, diffed series by their keys, counting
+// the events in the buckets holding latencies from min to max
+// (microseconds, 0 for no limit), largest first.
+func Contributions(keys []string, series [][]Sample, min, max float64) []Contribution {
+	lo, hi := LabelIndex(min), len(Labels)-1
+	if max > 0 {
+		hi = LabelIndex(max)
+	}
+	byKey := make(map[string]*Contribution)
+	ret := make([]Contribution, 0)
+	cell := 0.0
+	for x, s := range series {
+		c, ok := byKey[keys[x]]
+		if !ok {
+			c = &Contribution{Key: keys[x]}
+			byKey[keys[x]] = c
+		}
+		for _, sample := range s {
+			for y, v := range sample.Data {
+				v = Events(v)
+				c.Total += v
+				if y >= lo && y <= hi {
+					c.Count += v
+					cell += v
+				}
+			}
+		}
+	}
+	for _, c := range byKey {
+		if cell > 0 {
+			c.Share = c.Count / cell
+		}
+		ret = append(ret, *c)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Key < ret[j].Key
+	})
+	return ret
+}
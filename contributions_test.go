@@ -0,0 +1,35 @@
+package frank
+
+import (
+	"testing"
+)
+
+func TestContributions(t *testing.T) {
+	series := func(fast, slow float64) []Sample {
+		ret := make([]Sample, 2)
+		for x := range ret {
+			ret[x] = Sample{TimestampMS: int64(x) * 1000, Data: make([]float64, len(Labels))}
+			ret[x].Data[LabelIndex(500)] = fast
+			ret[x].Data[LabelIndex(50000)] = slow
+		}
+		return ret
+	}
+	reset := series(10, 1)
+	reset[1].Data[LabelIndex(50000)] = -100
+	got := Contributions(
+		[]string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.2"},
+		[][]Sample{series(10, 1), series(5, 3), reset, series(0, 1)},
+		10000, 100000)
+	if len(got) != 3 {
+		t.Fatalf("Invalid contributions : %+v", got)
+	}
+	if got[0].Key != "10.0.0.2" || got[0].Count != 8 || got[0].Share != 8.0/11 || got[0].Total != 18 {
+		t.Errorf("Invalid top contribution : %+v", got[0])
+	}
+	if got[1].Key != "10.0.0.1" || got[1].Count != 2 || got[2].Key != "10.0.0.3" || got[2].Count != 1 || got[2].Total != 21 {
+		t.Errorf("Invalid contributions : %+v", got[1:])
+	}
+	if got := Contributions(nil, nil, 0, 0); len(got) != 0 {
+		t.Errorf("Invalid contributions of nothing : %+v", got)
+	}
+}
@@ -0,0 +1,147 @@
+package frank
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// A Dashboard is a named page of panels drawn by dashboard.html. Range and
+// Interval, durations such as 1h and 10s, apply to every panel that does
+// not set its own.
+type Dashboard struct {
+	Name     string  `json:"name"`
+	Title    string  `json:"title,omitempty"`
+	Range    string  `json:"range"`
+	Interval string  `json:"interval"`
+	Panels   []Panel `json:"panels"`
+}
+
+// A Panel draws the meters matching Meter (path.Match on
+// cluster:node:cf:op), combined by Aggregation, as a heatmap or as
+// percentile lines. Heatmap cells are scaled by Normalize, one of
+// Normalizations.
+type Panel struct {
+	Title       string    `json:"title,omitempty"`
+	Type        string    `json:"type"`
+	Meter       string    `json:"meter"`
+	Aggregation string    `json:"aggregation,omitempty"`
+	Range       string    `json:"range,omitempty"`
+	Interval    string    `json:"interval,omitempty"`
+	ColorScale  string    `json:"color_scale,omitempty"`
+	Normalize   string    `json:"normalize,omitempty"`
+	Percentiles []float64 `json:"percentiles,omitempty"`
+}
+
+var (
+	PanelTypes   = []string{"heatmap", "percentiles"}
+	Aggregations = []string{"sum", "avg", "max"}
+	ColorScales  = []string{"linear", "log"}
+)
+
+func oneOf(v string, choices []string) bool {
+	for _, c := range choices {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+func validDuration(v string, min time.Duration) bool {
+	d, err := time.ParseDuration(v)
+	return err == nil && d >= min
+}
+
+func (d Dashboard) GetName() string {
+	return d.Name
+}
+
+func (d Dashboard) WithName(name string) Dashboard {
+	d.Name = name
+	return d
+}
+
+func (d Dashboard) Validate() error {
+	if err := ValidName("dashboard", d.Name); err != nil {
+		return err
+	}
+	if !validDuration(d.Range, time.Second) || !validDuration(d.Interval, time.Second) {
+		return fmt.Errorf("range and interval must be durations of at least 1s such as 1h and 10s")
+	}
+	if len(d.Panels) == 0 {
+		return fmt.Errorf("A dashboard needs at least one panel")
+	}
+	for x, p := range d.Panels {
+		if !oneOf(p.Type, PanelTypes) {
+			return fmt.Errorf("panel %d: type must be one of %s", x, strings.Join(PanelTypes, ", "))
+		}
+		if _, err := path.Match(p.Meter, ""); err != nil || p.Meter == "" {
+			return fmt.Errorf("panel %d: invalid meter pattern %q", x, p.Meter)
+		}
+		if p.Aggregation != "" && !oneOf(p.Aggregation, Aggregations) {
+			return fmt.Errorf("panel %d: aggregation must be one of %s", x, strings.Join(Aggregations, ", "))
+		}
+		if p.ColorScale != "" && !oneOf(p.ColorScale, ColorScales) {
+			return fmt.Errorf("panel %d: color_scale must be one of %s", x, strings.Join(ColorScales, ", "))
+		}
+		if p.Normalize != "" && !oneOf(p.Normalize, Normalizations) {
+			return fmt.Errorf("panel %d: normalize must be one of %s", x, strings.Join(Normalizations, ", "))
+		}
+		if (p.Range != "" && !validDuration(p.Range, time.Second)) || (p.Interval != "" && !validDuration(p.Interval, time.Second)) {
+			return fmt.Errorf("panel %d: range and interval must be durations of at least 1s", x)
+		}
+		for _, pc := range p.Percentiles {
+			if pc <= 0 || pc > 100 {
+				return fmt.Errorf("panel %d: percentiles must be between 0 and 100", x)
+			}
+		}
+	}
+	return nil
+}
+
+// Aggregate combines aligned series of the same range interval by interval
+// and bucket by bucket: sum adds them, avg divides the sum by the number of
+// series and max keeps the largest, such as the slowest node's, of their
+// Events.
+func Aggregate(series [][]Sample, how string) ([]Sample, error) {
+	if !oneOf(how, Aggregations) {
+		return nil, fmt.Errorf("Unknown aggregation %q", how)
+	}
+	if len(series) == 0 {
+		return []Sample{}, nil
+	}
+	ret := make([]Sample, len(series[0]))
+	for x := range ret {
+		ret[x] = Sample{TimestampMS: series[0][x].TimestampMS, Data: make([]float64, len(Labels))}
+	}
+	for _, s := range series {
+		if len(s) != len(ret) {
+			return nil, fmt.Errorf("Expected %d intervals, got %d", len(ret), len(s))
+		}
+		for x := range s {
+			for y, v := range s[x].Data {
+				if y >= len(Labels) {
+					continue
+				}
+				v = Events(v)
+				if how == "max" {
+					if v > ret[x].Data[y] {
+						ret[x].Data[y] = v
+					}
+				} else {
+					ret[x].Data[y] += v
+				}
+			}
+		}
+	}
+	if how == "avg" {
+		for x := range ret {
+			for y := range ret[x].Data {
+				ret[x].Data[y] /= float64(len(series))
+			}
+		}
+	}
+	return ret, nil
+}
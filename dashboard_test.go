@@ -0,0 +1,76 @@
+package frank
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	series := [][]Sample{
+		{{TimestampMS: 1000, Data: make([]float64, len(Labels))}, {TimestampMS: 2000, Data: make([]float64, len(Labels))}},
+		{{TimestampMS: 1000, Data: make([]float64, len(Labels))}, {TimestampMS: 2000, Data: make([]float64, len(Labels))}},
+	}
+	series[0][0].Data[3], series[1][0].Data[3] = 4, 2
+	series[0][1].Data[5], series[1][1].Data[5] = -7, 6
+	for how, want := range map[string][2]float64{"sum": {6, 6}, "avg": {3, 3}, "max": {4, 6}} {
+		got, err := Aggregate(series, how)
+		if err != nil {
+			t.Fatalf("Aggregate %s produced error: %s", how, err)
+		}
+		if len(got) != 2 || got[1].TimestampMS != 2000 || got[0].Data[3] != want[0] || got[1].Data[5] != want[1] {
+			t.Errorf("Invalid %s aggregate : %v, %v", how, got[0].Data[3], got[1].Data[5])
+		}
+	}
+	if _, err := Aggregate(series, "median"); err == nil {
+		t.Errorf("An unknown aggregation should produce an error")
+	}
+	if _, err := Aggregate([][]Sample{series[0], series[1][:1]}, "sum"); err == nil {
+		t.Errorf("Series of different lengths should produce an error")
+	}
+}
+
+func TestDashboards(t *testing.T) {
+	c := DefaultUtilityConfig()
+	c.SaveFile = filepath.Join(t.TempDir(), "frank.sav")
+	u := NewUtilityWithConfig(c)
+	d := Dashboard{Name: "writes", Range: "1h", Interval: "10s", Panels: []Panel{
+		{Type: "heatmap", Meter: "Prod:*:*:WriteLatency", Aggregation: "sum", ColorScale: "log"},
+		{Type: "percentiles", Meter: "Prod:*:*:WriteLatency", Aggregation: "max", Percentiles: []float64{50, 99}},
+	}}
+	if _, created, err := u.Dashboards.Put("writes", d); err != nil || !created {
+		t.Fatalf("Put produced error: %v, created %v", err, created)
+	}
+	if _, created, _ := u.Dashboards.Put("writes", d); created {
+		t.Errorf("Replacing a dashboard should not report it as new")
+	}
+	for _, bad := range []func(*Dashboard){
+		func(d *Dashboard) { d.Name = "a/b" },
+		func(d *Dashboard) { d.Range = "" },
+		func(d *Dashboard) { d.Panels = nil },
+		func(d *Dashboard) { d.Panels = []Panel{{Type: "pie", Meter: "*"}} },
+		func(d *Dashboard) { d.Panels = []Panel{{Type: "heatmap", Meter: "*", Aggregation: "median"}} },
+		func(d *Dashboard) { d.Panels = []Panel{{Type: "heatmap", Meter: "*", ColorScale: "rainbow"}} },
+		func(d *Dashboard) { d.Panels = []Panel{{Type: "heatmap", Meter: "*", Normalize: "sqrt"}} },
+		func(d *Dashboard) { d.Panels = []Panel{{Type: "percentiles", Meter: "*", Percentiles: []float64{101}}} },
+	} {
+		b := d
+		bad(&b)
+		if err := b.Validate(); err == nil {
+			t.Errorf("%+v should not be valid", b)
+		}
+	}
+	if err := u.Save(); err != nil {
+		t.Fatalf("Save produced error: %s", err)
+	}
+	u2 := NewUtilityWithConfig(c)
+	if err := u2.Load(); err != nil {
+		t.Fatalf("Load produced error: %s", err)
+	}
+	got, ok := u2.Dashboards.Get("writes")
+	if !ok || len(got.Panels) != 2 || got.Panels[1].Percentiles[1] != 99 {
+		t.Errorf("Invalid dashboard after Load : %+v", got)
+	}
+	if err := u2.Dashboards.Delete("writes"); err != nil || len(u2.Dashboards.All()) != 0 {
+		t.Errorf("Invalid dashboards after delete : %v, %v", u2.Dashboards.All(), err)
+	}
+}
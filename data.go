@@ -2,6 +2,7 @@ package frank
 
 import (
 	"sort"
+	"sync"
 	_ "fmt"
 )
 
@@ -15,17 +16,47 @@ type Sample struct {
 	Data []float64
 }
 
+// A NamedSample is a sample of the meter cluster:node:cf:op. Collectors
+// that name nodes by host_id also send the node's address, datacenter and
+// rack along.
 type NamedSample struct {
 	Sample
 	Name string
+	Node *NodeInfo
 }
 
 type Meter struct {
 	Name string
 	Data map[int64]Sample
+	mu sync.RWMutex
+}
+
+func (m *Meter) add(s Sample) {
+	m.mu.Lock()
+	m.Data[s.TimestampMS] = s
+	m.mu.Unlock()
+}
+
+// merge stores s unless the meter already holds a sample at the same time
+// that policy prefers, and reports whether there was one.
+func (m *Meter) merge(s Sample, policy MergePolicy) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, dup := m.Data[s.TimestampMS]
+	switch {
+	case !dup:
+	case policy == MergeKeep:
+		return true
+	case policy == MergeMax && Count(old.Data) >= Count(s.Data):
+		return true
+	}
+	m.Data[s.TimestampMS] = s
+	return dup
 }
 
 func (m *Meter) Cleanup(length int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if len(m.Data) > length {
 		keys := make(int64Slice, len(m.Data)+2)
 		count := 0
@@ -42,6 +73,8 @@ func (m *Meter) Cleanup(length int) {
 }
 
 func (m *Meter) Raw() ([]Sample, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	dts := make(int64Slice, len(m.Data))
 	count := 0
 	for ts, _ := range m.Data {
@@ -115,6 +148,16 @@ func Diff(src []Sample) []Sample {
 	return ret
 }
 
+// Events is how many events a bucket of a diffed sample holds. A counter
+// that was reset, as when a node restarts, goes down between two samples;
+// that negative delta counts as 0 events.
+func Events(delta float64) float64 {
+	if delta < 0 {
+		return 0
+	}
+	return delta
+}
+
 /*
 func main() {
 	tses := []int64{
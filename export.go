@@ -0,0 +1,373 @@
+package frank
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Export formats. Every format carries the bucket upper bounds from Labels.
+const (
+	// ExportCSV writes one meter,timestamp_ms,bucket,le,value row per
+	// timestamp and bucket.
+	ExportCSV = "csv"
+	// ExportCSVWide writes one row per timestamp with a le_<bound> column
+	// per bucket.
+	ExportCSVWide = "csv-wide"
+	// ExportJSONL writes a {"labels": [...]} line followed by one
+	// {"meter", "timestamp_ms", "data"} object per line.
+	ExportJSONL = "jsonl"
+	// ExportColumnar writes the columnar file described at WriteColumnar.
+	ExportColumnar = "columnar"
+)
+
+var ExportFormats = []string{ExportCSV, ExportCSVWide, ExportJSONL, ExportColumnar}
+
+// An Exporter writes the samples of one or more meters in one of the
+// export formats. Close must be called to flush the output.
+type Exporter interface {
+	Write(meter string, s Sample) error
+	Close() error
+}
+
+func NewExporter(w io.Writer, format string) (Exporter, error) {
+	switch format {
+	case ExportCSV:
+		return &csvExporter{w: csv.NewWriter(w)}, nil
+	case ExportCSVWide:
+		return &csvExporter{w: csv.NewWriter(w), wide: true}, nil
+	case ExportJSONL:
+		return &jsonlExporter{w: bufio.NewWriter(w)}, nil
+	case ExportColumnar:
+		return newColumnarExporter(w), nil
+	}
+	return nil, fmt.Errorf("Unknown export format %q", format)
+}
+
+// ExportContentType returns the HTTP content type and file extension of an
+// export format.
+func ExportContentType(format string) (string, string) {
+	switch format {
+	case ExportCSV, ExportCSVWide:
+		return "text/csv", "csv"
+	case ExportJSONL:
+		return "application/x-ndjson", "jsonl"
+	}
+	return "application/octet-stream", "frankcol"
+}
+
+// formatBound writes a Labels bound for CSV, with the overflow bucket as
+// +Inf.
+func formatBound(v float64) string {
+	if v == math.MaxFloat64 {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func checkBuckets(meter string, s Sample) error {
+	if len(s.Data) != len(Labels) {
+		return fmt.Errorf("Sample of %s at %d has %d buckets, expected %d", meter, s.TimestampMS, len(s.Data), len(Labels))
+	}
+	return nil
+}
+
+type csvExporter struct {
+	w      *csv.Writer
+	wide   bool
+	header bool
+}
+
+func (e *csvExporter) Write(meter string, s Sample) error {
+	if err := checkBuckets(meter, s); err != nil {
+		return err
+	}
+	if !e.header {
+		e.header = true
+		row := []string{"meter", "timestamp_ms", "bucket", "le", "value"}
+		if e.wide {
+			row = []string{"meter", "timestamp_ms"}
+			for _, l := range Labels {
+				row = append(row, "le_"+formatBound(l))
+			}
+		}
+		if err := e.w.Write(row); err != nil {
+			return err
+		}
+	}
+	ts := strconv.FormatInt(s.TimestampMS, 10)
+	if e.wide {
+		row := []string{meter, ts}
+		for _, v := range s.Data {
+			row = append(row, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		return e.w.Write(row)
+	}
+	for x, v := range s.Data {
+		row := []string{meter, ts, strconv.Itoa(x), formatBound(Labels[x]), strconv.FormatFloat(v, 'g', -1, 64)}
+		if err := e.w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *csvExporter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonlExporter struct {
+	w      *bufio.Writer
+	header bool
+}
+
+type jsonlRecord struct {
+	Meter       string    `json:"meter"`
+	TimestampMS int64     `json:"timestamp_ms"`
+	Data        []float64 `json:"data"`
+}
+
+func (e *jsonlExporter) line(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	e.w.Write(data)
+	return e.w.WriteByte('\n')
+}
+
+func (e *jsonlExporter) Write(meter string, s Sample) error {
+	if err := checkBuckets(meter, s); err != nil {
+		return err
+	}
+	if !e.header {
+		e.header = true
+		if err := e.line(map[string][]float64{"labels": Labels}); err != nil {
+			return err
+		}
+	}
+	return e.line(jsonlRecord{meter, s.TimestampMS, s.Data})
+}
+
+func (e *jsonlExporter) Close() error {
+	return e.w.Flush()
+}
+
+// Columnar is an export, or one row group of it, held column by column:
+// row i is meter Meters[Meter[i]] at TimestampMS[i], with the value of
+// bucket b in Buckets[b][i].
+type Columnar struct {
+	Labels      []float64
+	Meters      []string
+	Meter       []uint32
+	TimestampMS []int64
+	Buckets     [][]float64
+}
+
+// The columnar file is little endian. Rows are written in groups of at most
+// columnarGroupRows as they come, each group with its own meter names, and
+// a group without rows ends the file:
+//
+//	"FRANKCOL" uint32(version)
+//	uint32(buckets) float64 bound * buckets
+//	group *
+//	uint32(0) uint32(0)
+//
+// where a group is
+//
+//	uint32(meters) (uint32(len) name) * meters
+//	uint32(rows)
+//	uint32 meter index * rows
+//	int64 timestamp_ms * rows
+//	(float64 value * rows) * buckets
+//
+// Version 1 files hold a single group and no end.
+const (
+	columnarMagic   = "FRANKCOL"
+	columnarVersion = 2
+)
+
+var columnarGroupRows = 4096
+
+type columnarExporter struct {
+	w      *bufio.Writer
+	header bool
+	group  *Columnar
+	meters map[string]uint32
+}
+
+func newColumnarExporter(w io.Writer) *columnarExporter {
+	return &columnarExporter{w: bufio.NewWriter(w)}
+}
+
+func (e *columnarExporter) Write(meter string, s Sample) error {
+	if err := checkBuckets(meter, s); err != nil {
+		return err
+	}
+	if e.group == nil {
+		e.group = &Columnar{Labels: Labels, Buckets: make([][]float64, len(Labels))}
+		e.meters = make(map[string]uint32)
+	}
+	g := e.group
+	idx, ok := e.meters[meter]
+	if !ok {
+		idx = uint32(len(g.Meters))
+		e.meters[meter] = idx
+		g.Meters = append(g.Meters, meter)
+	}
+	g.Meter = append(g.Meter, idx)
+	g.TimestampMS = append(g.TimestampMS, s.TimestampMS)
+	for x, v := range s.Data {
+		g.Buckets[x] = append(g.Buckets[x], v)
+	}
+	if len(g.TimestampMS) >= columnarGroupRows {
+		return e.flush()
+	}
+	return nil
+}
+
+// flush writes the file header if it has not been yet and the pending
+// group, if any, and passes them on to the underlying writer.
+func (e *columnarExporter) flush() error {
+	if !e.header {
+		e.header = true
+		writeColumnarHeader(e.w, Labels)
+	}
+	if e.group != nil {
+		writeColumnarGroup(e.w, e.group)
+		e.group = nil
+	}
+	return e.w.Flush()
+}
+
+func (e *columnarExporter) Close() error {
+	if err := e.flush(); err != nil {
+		return err
+	}
+	writeColumnarGroup(e.w, &Columnar{})
+	return e.w.Flush()
+}
+
+func writeColumnarHeader(w *bufio.Writer, labels []float64) {
+	w.WriteString(columnarMagic)
+	binary.Write(w, binary.LittleEndian, uint32(columnarVersion))
+	binary.Write(w, binary.LittleEndian, uint32(len(labels)))
+	binary.Write(w, binary.LittleEndian, labels)
+}
+
+func writeColumnarGroup(w *bufio.Writer, c *Columnar) {
+	put := func(v interface{}) {
+		binary.Write(w, binary.LittleEndian, v)
+	}
+	put(uint32(len(c.Meters)))
+	for _, name := range c.Meters {
+		put(uint32(len(name)))
+		w.WriteString(name)
+	}
+	put(uint32(len(c.TimestampMS)))
+	if len(c.TimestampMS) == 0 {
+		return
+	}
+	put(c.Meter)
+	put(c.TimestampMS)
+	for x := range c.Buckets {
+		put(c.Buckets[x])
+	}
+}
+
+// WriteColumnar writes c as a columnar file of a single group.
+func WriteColumnar(w io.Writer, c *Columnar) error {
+	bw := bufio.NewWriter(w)
+	writeColumnarHeader(bw, c.Labels)
+	if len(c.TimestampMS) > 0 {
+		writeColumnarGroup(bw, c)
+	}
+	writeColumnarGroup(bw, &Columnar{})
+	return bw.Flush()
+}
+
+// ReadColumnar reads a whole columnar file, joining its groups into one
+// Columnar with a single list of meters.
+func ReadColumnar(r io.Reader) (*Columnar, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(columnarMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != columnarMagic {
+		return nil, fmt.Errorf("Not a frank columnar file")
+	}
+	var err error
+	get := func(v interface{}) {
+		if err == nil {
+			err = binary.Read(br, binary.LittleEndian, v)
+		}
+	}
+	var version, buckets uint32
+	get(&version)
+	if err == nil && version != 1 && version != columnarVersion {
+		return nil, fmt.Errorf("Unsupported columnar version %d", version)
+	}
+	c := &Columnar{}
+	get(&buckets)
+	if err != nil {
+		return nil, err
+	}
+	c.Labels = make([]float64, buckets)
+	get(c.Labels)
+	c.Buckets = make([][]float64, buckets)
+	meterIdx := make(map[string]uint32)
+	for err == nil {
+		var meters, rows uint32
+		get(&meters)
+		names := make([]uint32, 0, meters)
+		for x := uint32(0); x < meters && err == nil; x++ {
+			var size uint32
+			get(&size)
+			name := make([]byte, size)
+			if err == nil {
+				_, err = io.ReadFull(br, name)
+			}
+			idx, ok := meterIdx[string(name)]
+			if !ok {
+				idx = uint32(len(c.Meters))
+				meterIdx[string(name)] = idx
+				c.Meters = append(c.Meters, string(name))
+			}
+			names = append(names, idx)
+		}
+		get(&rows)
+		if err != nil || (rows == 0 && version != 1) {
+			break
+		}
+		meter := make([]uint32, rows)
+		ts := make([]int64, rows)
+		get(meter)
+		get(ts)
+		if err != nil {
+			break
+		}
+		for _, m := range meter {
+			if int(m) >= len(names) {
+				return nil, fmt.Errorf("Invalid meter index %d in a group of %d meters", m, len(names))
+			}
+			c.Meter = append(c.Meter, names[m])
+		}
+		c.TimestampMS = append(c.TimestampMS, ts...)
+		for x := range c.Buckets {
+			col := make([]float64, rows)
+			get(col)
+			c.Buckets[x] = append(c.Buckets[x], col...)
+		}
+		if version == 1 {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
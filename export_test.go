@@ -0,0 +1,142 @@
+package frank
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func exportSamples() []Sample {
+	a := make([]float64, len(Labels))
+	b := make([]float64, len(Labels))
+	a[3], b[3], b[90] = 5, 7, 1
+	return []Sample{{1410000000000, a}, {1410000005000, b}}
+}
+
+func export(t *testing.T, format string) []byte {
+	var buf bytes.Buffer
+	e, err := NewExporter(&buf, format)
+	if err != nil {
+		t.Fatalf("NewExporter(%s) produced error: %s", format, err)
+	}
+	for _, s := range exportSamples() {
+		if err := e.Write("C:n:ks.cf:Read", s); err != nil {
+			t.Fatalf("Write(%s) produced error: %s", format, err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close(%s) produced error: %s", format, err)
+	}
+	return buf.Bytes()
+}
+
+func TestExportCSV(t *testing.T) {
+	rows, err := csv.NewReader(bytes.NewReader(export(t, ExportCSV))).ReadAll()
+	if err != nil {
+		t.Fatalf("Unable to read csv: %s", err)
+	}
+	if len(rows) != 1+2*len(Labels) {
+		t.Fatalf("Expected %d rows, got %d", 1+2*len(Labels), len(rows))
+	}
+	if got := strings.Join(rows[4], ","); got != "C:n:ks.cf:Read,1410000000000,3,4,5" {
+		t.Errorf("Unexpected bucket row %s", got)
+	}
+	if got := rows[len(rows)-1]; got[3] != "+Inf" || got[4] != "1" {
+		t.Errorf("Unexpected overflow row %v", got)
+	}
+}
+
+func TestExportCSVWide(t *testing.T) {
+	rows, err := csv.NewReader(bytes.NewReader(export(t, ExportCSVWide))).ReadAll()
+	if err != nil {
+		t.Fatalf("Unable to read csv: %s", err)
+	}
+	if len(rows) != 3 || len(rows[0]) != 2+len(Labels) {
+		t.Fatalf("Expected 3 rows of %d columns, got %d rows of %d", 2+len(Labels), len(rows), len(rows[0]))
+	}
+	if rows[0][5] != "le_4" || rows[0][len(Labels)+1] != "le_+Inf" || rows[2][5] != "7" {
+		t.Errorf("Unexpected header %v or row %v", rows[0][:6], rows[2][:6])
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(string(export(t, ExportJSONL))), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a labels line and 2 samples, got %d lines", len(lines))
+	}
+	var header map[string][]float64
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || len(header["labels"]) != len(Labels) {
+		t.Errorf("Unexpected labels line %s : %v", lines[0], err)
+	}
+	var rec jsonlRecord
+	if err := json.Unmarshal([]byte(lines[2]), &rec); err != nil {
+		t.Fatalf("Unable to read record: %s", err)
+	}
+	if rec.Meter != "C:n:ks.cf:Read" || rec.TimestampMS != 1410000005000 || rec.Data[3] != 7 {
+		t.Errorf("Unexpected record %v", rec)
+	}
+}
+
+func TestExportColumnar(t *testing.T) {
+	c, err := ReadColumnar(bytes.NewReader(export(t, ExportColumnar)))
+	if err != nil {
+		t.Fatalf("ReadColumnar produced error: %s", err)
+	}
+	if len(c.Labels) != len(Labels) || c.Labels[8] != 10 {
+		t.Errorf("Labels changed by columnar file : %v", c.Labels[:9])
+	}
+	if len(c.Meters) != 1 || c.Meters[0] != "C:n:ks.cf:Read" || len(c.Meter) != 2 {
+		t.Errorf("Unexpected meters %v %v", c.Meters, c.Meter)
+	}
+	if c.TimestampMS[1] != 1410000005000 || c.Buckets[3][0] != 5 || c.Buckets[3][1] != 7 || c.Buckets[90][1] != 1 {
+		t.Errorf("Unexpected columns %v %v %v", c.TimestampMS, c.Buckets[3], c.Buckets[90])
+	}
+	if _, err := ReadColumnar(strings.NewReader("meter,timestamp_ms")); err == nil {
+		t.Errorf("Expected an error reading a non columnar file")
+	}
+}
+
+func TestExportColumnarGroups(t *testing.T) {
+	defer func(rows int) { columnarGroupRows = rows }(columnarGroupRows)
+	columnarGroupRows = 2
+	var buf bytes.Buffer
+	e, _ := NewExporter(&buf, ExportColumnar)
+	for x, s := range append(exportSamples(), exportSamples()...) {
+		meter := "C:n:ks.cf:Read"
+		if x%2 == 1 {
+			meter = "C:n:ks.cf:Write"
+		}
+		if err := e.Write(meter, s); err != nil {
+			t.Fatalf("Write produced error: %s", err)
+		}
+		if x == 1 && buf.Len() == 0 {
+			t.Errorf("A full row group should be written before Close")
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close produced error: %s", err)
+	}
+	data := buf.Bytes()
+	c, err := ReadColumnar(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadColumnar produced error: %s", err)
+	}
+	if len(c.Meters) != 2 || len(c.Meter) != 4 || c.Meters[c.Meter[3]] != "C:n:ks.cf:Write" || c.Buckets[3][3] != 7 {
+		t.Errorf("Unexpected columns %v %v %v", c.Meters, c.Meter, c.Buckets[3])
+	}
+	if _, err := ReadColumnar(bytes.NewReader(data[:len(data)-8])); err == nil {
+		t.Errorf("Expected an error reading a file without its end")
+	}
+}
+
+func TestExportBadFormat(t *testing.T) {
+	if _, err := NewExporter(&bytes.Buffer{}, "parquet"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+	e, _ := NewExporter(&bytes.Buffer{}, ExportCSV)
+	if err := e.Write("C:n:ks.cf:Read", Sample{1, []float64{1, 2}}); err == nil {
+		t.Errorf("Expected an error for a short sample")
+	}
+}
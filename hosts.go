@@ -0,0 +1,54 @@
+package frank
+
+// NodeInfo describes a Cassandra node. The collector names the node part of
+// its meters by HostID, which stays the same when the node's address
+// changes, and sends the rest along so that it can be shown instead.
+type NodeInfo struct {
+	HostID     string `json:"host_id"`
+	Address    string `json:"address"`
+	Datacenter string `json:"datacenter"`
+	Rack       string `json:"rack"`
+}
+
+// SetNodeInfo records what node (a host_id) of cluster currently is.
+func (u *Utility) SetNodeInfo(cluster, node string, n NodeInfo) {
+	u.mu.RLock()
+	known, ok := u.hosts[cluster][node]
+	u.mu.RUnlock()
+	if ok && known == n {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.hosts[cluster] == nil {
+		u.hosts[cluster] = make(map[string]NodeInfo)
+	}
+	u.hosts[cluster][node] = n
+}
+
+// NodeInfos returns what is known of the nodes of cluster, by the node
+// part of their meter names.
+func (u *Utility) NodeInfos(cluster string) map[string]NodeInfo {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	ret := make(map[string]NodeInfo)
+	for node, n := range u.hosts[cluster] {
+		ret[node] = n
+	}
+	return ret
+}
+
+func (u *Utility) saveHosts() error {
+	return u.saveSidecar("hosts", &u.hosts)
+}
+
+func (u *Utility) loadHosts() error {
+	loaded := make(map[string]map[string]NodeInfo)
+	if err := u.loadSidecar("hosts", &loaded); err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.hosts = loaded
+	return nil
+}
@@ -0,0 +1,136 @@
+// Package jolokiatest provides a fake Jolokia agent for testing collectors
+// without a running Cassandra.
+package jolokiatest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Server struct {
+	*httptest.Server
+	Path string
+
+	mu    sync.Mutex
+	attrs map[string]func() interface{}
+	reads map[string]int
+}
+
+// NewServer starts a fake agent answering read and version requests under
+// path (usually "/jolokia").
+func NewServer(path string) *Server {
+	s := &Server{
+		Path:  strings.TrimRight(path, "/"),
+		attrs: make(map[string]func() interface{}),
+		reads: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func key(domain, bean, attr string) string {
+	return domain + ":" + bean + "/" + attr
+}
+
+// Set serves a fixed value for the attribute.
+func (s *Server) Set(domain, bean, attr string, value interface{}) {
+	s.SetFunc(domain, bean, attr, func() interface{} { return value })
+}
+
+// SetFunc serves the result of calling f on every read of the attribute.
+func (s *Server) SetFunc(domain, bean, attr string, f func() interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs[key(domain, bean, attr)] = f
+}
+
+// Reads returns how many times the attribute has been read.
+func (s *Server) Reads(domain, bean, attr string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads[key(domain, bean, attr)]
+}
+
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Listener.Addr().String())
+	return host
+}
+
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, s.Path+"/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	req := strings.TrimPrefix(r.URL.Path, s.Path+"/")
+	switch {
+	case req == "version":
+		reply(w, http.StatusOK, map[string]interface{}{"agent": "1.3.7", "protocol": "7.2"}, "")
+	case strings.HasPrefix(req, "read/"):
+		s.read(w, strings.TrimPrefix(req, "read/"))
+	default:
+		reply(w, http.StatusBadRequest, nil, "Unknown request "+req)
+	}
+}
+
+func (s *Server) read(w http.ResponseWriter, req string) {
+	slash := strings.LastIndex(req, "/")
+	if slash < 0 {
+		reply(w, http.StatusBadRequest, nil, "No attribute in "+req)
+		return
+	}
+	s.mu.Lock()
+	f, ok := s.attrs[req]
+	if ok {
+		s.reads[req]++
+	}
+	s.mu.Unlock()
+	if !ok {
+		reply(w, http.StatusNotFound, nil, "javax.management.InstanceNotFoundException : "+req[:slash])
+		return
+	}
+	reply(w, http.StatusOK, f(), "")
+}
+
+// Jolokia reports errors in the body with an HTTP 200.
+func reply(w http.ResponseWriter, status int, value interface{}, errmsg string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"value":  value,
+		"status": status,
+		"error":  errmsg,
+	})
+}
+
+// Histogram returns a value function for a size bucket histogram that
+// grows by rate[x] in bucket x on every read, like Cassandra's lifetime
+// histograms. With recent set it returns only the growth since the last
+// read, like the RecentValues attribute of the metrics registry.
+func Histogram(size int, rate func(x int) float64, recent bool) func() interface{} {
+	var mu sync.Mutex
+	total := make([]float64, size)
+	return func() interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		ret := make([]interface{}, size)
+		for x := range total {
+			total[x] += rate(x)
+			if recent {
+				ret[x] = rate(x)
+			} else {
+				ret[x] = total[x]
+			}
+		}
+		return ret
+	}
+}
@@ -97,3 +97,44 @@ var Labels = []float64{
 	25109160,
 	math.MaxFloat64,
 }
+
+// HistogramOffsets returns the first size bucket bounds of Cassandra's
+// EstimatedHistogram. Labels is HistogramOffsets(90) plus an overflow bucket.
+func HistogramOffsets(size int) []float64 {
+	ret := make([]float64, size)
+	last := float64(1)
+	for x := 0; x < size; x++ {
+		ret[x] = last
+		next := math.Floor(last*1.2 + 0.5)
+		if next == last {
+			next++
+		}
+		last = next
+	}
+	return ret
+}
+
+// LabelIndex returns the index of the Labels bucket that holds value.
+func LabelIndex(value float64) int {
+	for x, l := range Labels {
+		if value <= l {
+			return x
+		}
+	}
+	return len(Labels) - 1
+}
+
+// Rebucket maps histogram counts whose upper bucket bounds are given by
+// bounds onto Labels. data may be one longer than bounds, in which case its
+// last element is an overflow bucket.
+func Rebucket(data []float64, bounds []float64) []float64 {
+	ret := make([]float64, len(Labels))
+	for x, val := range data {
+		if x < len(bounds) {
+			ret[LabelIndex(bounds[x])] += val
+		} else {
+			ret[len(Labels)-1] += val
+		}
+	}
+	return ret
+}
@@ -0,0 +1,32 @@
+package frank
+
+import "testing"
+
+func TestHistogramOffsets(t *testing.T) {
+	offsets := HistogramOffsets(len(Labels) - 1)
+	for x, o := range offsets {
+		if o != Labels[x] {
+			t.Errorf("Offset %d is %f, should be %f", x, o, Labels[x])
+		}
+	}
+}
+
+func TestRebucket(t *testing.T) {
+	bounds := HistogramOffsets(164)
+	data := make([]float64, 165)
+	data[0] = 1
+	data[89] = 2
+	data[90] = 3
+	data[164] = 4
+	res := Rebucket(data, bounds)
+	if len(res) != len(Labels) {
+		t.Errorf("Invalid length : %d, should be %d", len(res), len(Labels))
+		return
+	}
+	if res[0] != 1 || res[89] != 2 {
+		t.Errorf("Matching buckets moved : %v", res)
+	}
+	if res[90] != 7 {
+		t.Errorf("Overflow bucket is %f, should be 7", res[90])
+	}
+}
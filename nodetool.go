@@ -0,0 +1,167 @@
+package frank
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NodetoolOps maps the columns of nodetool cfhistograms/tablehistograms to
+// the meter operation the collector uses for the same data, so imported
+// history lines up with collected meters.
+var NodetoolOps = map[string]string{
+	"SSTables":       "SSTablesPerReadHistogram",
+	"Write Latency":  "LifetimeWriteLatencyHistogramMicros",
+	"Read Latency":   "LifetimeReadLatencyHistogramMicros",
+	"Row Size":       "EstimatedRowSizeHistogram",
+	"Partition Size": "EstimatedRowSizeHistogram",
+	"Column Count":   "EstimatedColumnCountHistogram",
+	"Cell Count":     "EstimatedColumnCountHistogram",
+}
+
+// NodetoolHistograms is one table of nodetool histograms output, with each
+// known column folded onto Labels and keyed by its NodetoolOps operation.
+type NodetoolHistograms struct {
+	Keyspace    string
+	Table       string
+	Percentiles bool
+	Ops         map[string][]float64
+}
+
+var (
+	nodetoolTitle  = regexp.MustCompile(`^(\S+)/(\S+) histograms$`)
+	nodetoolColumn = regexp.MustCompile(`\s{2,}`)
+	// The share of events below each percentile row, Min and Max included.
+	nodetoolRanks = map[string]float64{"Min": 0, "50%": 50, "75%": 75, "95%": 95, "98%": 98, "99%": 99, "Max": 100}
+)
+
+// ParseNodetoolHistograms reads the output of nodetool cfhistograms or
+// tablehistograms, one or more tables of it. Cassandra before 2.1 prints a
+// count per EstimatedHistogram offset, which maps directly onto Labels.
+// Later versions print only percentiles, so count events are spread between
+// the percentile values: 50% of them at the median, 25% at the 75th
+// percentile and so on, which keeps the percentiles of the result.
+func ParseNodetoolHistograms(r io.Reader, count float64) ([]NodetoolHistograms, error) {
+	ret := make([]NodetoolHistograms, 0)
+	var (
+		cur     *NodetoolHistograms
+		columns []string
+		ranks   []float64
+		values  [][]float64
+	)
+	finish := func() {
+		if cur == nil || len(columns) == 0 {
+			return
+		}
+		for x, col := range columns[1:] {
+			op, ok := NodetoolOps[col]
+			if !ok {
+				continue
+			}
+			if cur.Percentiles {
+				cur.Ops[op] = spreadPercentiles(ranks, values[x], count)
+			} else {
+				cur.Ops[op] = values[x]
+			}
+		}
+		ret = append(ret, *cur)
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "("):
+			continue
+		case nodetoolTitle.MatchString(line):
+			finish()
+			m := nodetoolTitle.FindStringSubmatch(line)
+			cur = &NodetoolHistograms{Keyspace: m[1], Table: m[2], Ops: make(map[string][]float64)}
+			columns = nil
+			continue
+		case strings.HasPrefix(line, "Offset") || strings.HasPrefix(line, "Percentile"):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: histograms without a keyspace/table title", lineno)
+			}
+			columns = nodetoolColumn.Split(line, -1)
+			cur.Percentiles = columns[0] == "Percentile"
+			ranks = nil
+			values = make([][]float64, len(columns)-1)
+			for x := range values {
+				if cur.Percentiles {
+					values[x] = make([]float64, 0)
+				} else {
+					values[x] = make([]float64, len(Labels))
+				}
+			}
+			continue
+		case columns == nil:
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != len(columns) {
+			return nil, fmt.Errorf("line %d: expected %d columns, found %d", lineno, len(columns), len(fields))
+		}
+		var offset float64
+		if cur.Percentiles {
+			rank, ok := nodetoolRanks[fields[0]]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown percentile %q", lineno, fields[0])
+			}
+			ranks = append(ranks, rank)
+		} else {
+			o, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid offset %q", lineno, fields[0])
+			}
+			offset = o
+		}
+		for x, f := range fields[1:] {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid value %q", lineno, f)
+			}
+			// tablehistograms prints NaN for sizes of empty tables
+			if math.IsNaN(v) {
+				v = 0
+			}
+			if cur.Percentiles {
+				values[x] = append(values[x], v)
+			} else {
+				values[x][LabelIndex(offset)] += v
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	finish()
+	return ret, nil
+}
+
+// spreadPercentiles builds a histogram of count events from percentile
+// values, putting the events between two ranks in the bucket of the upper
+// one. A column of zeros, as printed for a table without reads or writes,
+// has no events.
+func spreadPercentiles(ranks []float64, values []float64, count float64) []float64 {
+	ret := make([]float64, len(Labels))
+	if Count(values) == 0 {
+		return ret
+	}
+	last := 0.0
+	for x, rank := range ranks {
+		if rank <= last {
+			continue
+		}
+		ret[LabelIndex(values[x])] += (rank - last) / 100 * count
+		last = rank
+	}
+	return ret
+}
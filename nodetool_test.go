@@ -0,0 +1,94 @@
+package frank
+
+import (
+	"strings"
+	"testing"
+)
+
+const legacyHistograms = `Space1/Test1 histograms
+Offset      SSTables     Write Latency      Read Latency          Row Size      Column Count
+1                 10                 0                 0                 0                 0
+2                  3                 0                 0                 0                 0
+24                 0                40                 0                 0                 0
+29                 0                 2                 0                 0                 0
+1331               0                 0                 7                 0                 0
+`
+
+const modernHistograms = `Space1/Test1 histograms
+Percentile  SSTables     Write Latency      Read Latency    Partition Size        Cell Count
+                              (micros)          (micros)           (bytes)
+50%             1.00             20.50            454.83               179                 3
+75%             1.00             24.60            545.79               179                 3
+95%             2.00             35.43            943.13               179                 3
+98%             2.00             42.51           1131.75               179                 3
+99%             3.00             61.21           1358.10               179                 3
+Min             0.00              3.31            219.34               150                 3
+Max             3.00            454.83           1955.67               179                 3
+
+Space1/Test2 histograms
+Percentile      Read Latency     Write Latency          SSTables    Partition Size        Cell Count
+                    (micros)          (micros)                             (bytes)
+50%                     0.00             17.08              0.00               NaN               NaN
+Min                     0.00              6.87              0.00               NaN               NaN
+Max                     0.00             17.08              0.00               NaN               NaN
+`
+
+func TestParseNodetoolLegacy(t *testing.T) {
+	hists, err := ParseNodetoolHistograms(strings.NewReader(legacyHistograms), 100)
+	if err != nil {
+		t.Fatalf("ParseNodetoolHistograms produced error: %s", err)
+	}
+	if len(hists) != 1 || hists[0].Keyspace != "Space1" || hists[0].Table != "Test1" || hists[0].Percentiles {
+		t.Fatalf("Unexpected tables %v", hists)
+	}
+	w := hists[0].Ops["LifetimeWriteLatencyHistogramMicros"]
+	if len(w) != len(Labels) || w[13] != 40 || w[14] != 2 || Count(w) != 42 {
+		t.Errorf("Unexpected write latency %v", w)
+	}
+	if r := hists[0].Ops["LifetimeReadLatencyHistogramMicros"]; r[LabelIndex(1331)] != 7 {
+		t.Errorf("Unexpected read latency %v", r)
+	}
+	if s := hists[0].Ops["SSTablesPerReadHistogram"]; s[0] != 10 || s[1] != 3 {
+		t.Errorf("Unexpected sstables %v", s)
+	}
+}
+
+func TestParseNodetoolPercentiles(t *testing.T) {
+	hists, err := ParseNodetoolHistograms(strings.NewReader(modernHistograms), 1000)
+	if err != nil {
+		t.Fatalf("ParseNodetoolHistograms produced error: %s", err)
+	}
+	if len(hists) != 2 || !hists[0].Percentiles || hists[1].Table != "Test2" {
+		t.Fatalf("Unexpected tables %v", hists)
+	}
+	r := hists[0].Ops["LifetimeReadLatencyHistogramMicros"]
+	if Count(r) != 1000 {
+		t.Errorf("Unexpected read latency count %f", Count(r))
+	}
+	for _, p := range []float64{50, 95, 99} {
+		if got, want := Percentile(r, p), Labels[LabelIndex(map[float64]float64{50: 454.83, 95: 943.13, 99: 1358.10}[p])]; got != want {
+			t.Errorf("p%g changed by import : %f, should be %f", p, got, want)
+		}
+	}
+	if w := hists[1].Ops["LifetimeWriteLatencyHistogramMicros"]; Percentile(w, 50) != 20 {
+		t.Errorf("Unexpected Test2 write median %f", Percentile(w, 50))
+	}
+	if r := hists[1].Ops["LifetimeReadLatencyHistogramMicros"]; Count(r) != 0 {
+		t.Errorf("Table without reads should have no read events : %v", r)
+	}
+	if s := hists[1].Ops["EstimatedRowSizeHistogram"]; Count(s) != 0 {
+		t.Errorf("NaN sizes should have no events : %v", s)
+	}
+}
+
+func TestParseNodetoolErrors(t *testing.T) {
+	for _, in := range []string{
+		"Offset  SSTables\n1  0\n",
+		"Space1/Test1 histograms\nPercentile  SSTables\n42%  1.00\n",
+		"Space1/Test1 histograms\nOffset  SSTables  Write Latency\n1  0\n",
+	} {
+		if _, err := ParseNodetoolHistograms(strings.NewReader(in), 100); err == nil {
+			t.Errorf("Expected an error parsing %q", in)
+		}
+	}
+}
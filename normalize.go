@@ -0,0 +1,120 @@
+package frank
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Normalizations are the ways heatmap cells can be scaled before coloring:
+// count leaves the events as they are, fraction divides each by the events
+// of its interval, log takes log10(1+count), and zscore is the number of
+// standard deviations a cell is from the mean of its bucket over the range.
+var Normalizations = []string{"count", "fraction", "log", "zscore"}
+
+// normalizeGrid scales the Events of cols, indexed by interval then bucket,
+// in place.
+func normalizeGrid(cols [][]float64, mode string) error {
+	if mode != "" && !oneOf(mode, Normalizations) {
+		return fmt.Errorf("Unknown normalization %q", mode)
+	}
+	for _, c := range cols {
+		for y, v := range c {
+			c[y] = Events(v)
+		}
+	}
+	switch mode {
+	case "fraction":
+		for _, c := range cols {
+			if total := Count(c); total > 0 {
+				for y := range c {
+					c[y] /= total
+				}
+			}
+		}
+	case "log":
+		for _, c := range cols {
+			for y, v := range c {
+				c[y] = math.Log10(1 + v)
+			}
+		}
+	case "zscore":
+		if len(cols) == 0 {
+			return nil
+		}
+		for y := range cols[0] {
+			sum, sq := 0.0, 0.0
+			for _, c := range cols {
+				sum += c[y]
+				sq += c[y] * c[y]
+			}
+			mean := sum / float64(len(cols))
+			std := math.Sqrt(math.Max(0, sq/float64(len(cols))-mean*mean))
+			for _, c := range cols {
+				if std > 0 {
+					c[y] = (c[y] - mean) / std
+				} else {
+					c[y] = 0
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Normalize returns a copy of aligned, diffed samples scaled by mode, one
+// of Normalizations; an empty mode is count.
+func Normalize(samples []Sample, mode string) ([]Sample, error) {
+	ret := make([]Sample, len(samples))
+	cols := make([][]float64, len(samples))
+	for x, s := range samples {
+		ret[x] = Sample{TimestampMS: s.TimestampMS, Data: append([]float64{}, s.Data...)}
+		cols[x] = ret[x].Data
+	}
+	if err := normalizeGrid(cols, mode); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ValueStats describe the non-zero cells of a heatmap, for picking a color
+// scale that neither hides quiet tables nor saturates busy ones.
+type ValueStats struct {
+	Cells  int     `json:"cells"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	P50    float64 `json:"p50"`
+	P90    float64 `json:"p90"`
+	P99    float64 `json:"p99"`
+}
+
+func Stats(samples []Sample) ValueStats {
+	values := make([]float64, 0)
+	for _, s := range samples {
+		for _, v := range s.Data {
+			if v != 0 {
+				values = append(values, v)
+			}
+		}
+	}
+	st := ValueStats{Cells: len(values)}
+	if len(values) == 0 {
+		return st
+	}
+	sort.Float64s(values)
+	sum, sq := 0.0, 0.0
+	for _, v := range values {
+		sum += v
+		sq += v * v
+	}
+	n := float64(len(values))
+	st.Min, st.Max, st.Mean = values[0], values[len(values)-1], sum/n
+	st.StdDev = math.Sqrt(math.Max(0, sq/n-st.Mean*st.Mean))
+	rank := func(p float64) float64 {
+		return values[int(math.Ceil(p/100*n))-1]
+	}
+	st.P50, st.P90, st.P99 = rank(50), rank(90), rank(99)
+	return st
+}
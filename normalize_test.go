@@ -0,0 +1,48 @@
+package frank
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	samples := make([]Sample, 4)
+	for x := range samples {
+		samples[x] = Sample{TimestampMS: int64(x) * 1000, Data: make([]float64, len(Labels))}
+		samples[x].Data[10] = 30
+		samples[x].Data[20] = 10
+	}
+	samples[3].Data[20] = 90
+	samples[2].Data[30] = -5
+
+	frac, err := Normalize(samples, "fraction")
+	if err != nil {
+		t.Fatalf("Normalize produced error: %s", err)
+	}
+	if frac[0].Data[10] != 0.75 || frac[3].Data[20] != 0.75 || frac[2].Data[30] != 0 {
+		t.Errorf("Invalid fractions : %v %v %v", frac[0].Data[10], frac[3].Data[20], frac[2].Data[30])
+	}
+	if samples[0].Data[10] != 30 {
+		t.Errorf("Normalize changed its input")
+	}
+	lg, _ := Normalize(samples, "log")
+	if math.Abs(lg[3].Data[20]-math.Log10(91)) > 1e-9 {
+		t.Errorf("Invalid log : %v", lg[3].Data[20])
+	}
+	z, _ := Normalize(samples, "zscore")
+	// Bucket 20 is 10, 10, 10, 90: mean 30, standard deviation 34.64.
+	if math.Abs(z[3].Data[20]-60/math.Sqrt(1200)) > 1e-9 || z[0].Data[10] != 0 {
+		t.Errorf("Invalid zscores : %v %v", z[3].Data[20], z[0].Data[10])
+	}
+	if _, err := Normalize(samples, "sqrt"); err == nil {
+		t.Errorf("An unknown normalization should produce an error")
+	}
+
+	st := Stats(samples)
+	if st.Cells != 9 || st.Min != -5 || st.Max != 90 || st.P50 != 30 || st.P99 != 90 {
+		t.Errorf("Invalid stats : %+v", st)
+	}
+	if st := Stats(nil); st.Cells != 0 || st.Max != 0 {
+		t.Errorf("Invalid stats of nothing : %+v", st)
+	}
+}
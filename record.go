@@ -0,0 +1,36 @@
+package frank
+
+import (
+	"encoding/gob"
+	"io"
+)
+
+// A recording is the same gob stream of NamedSamples that collectors send
+// to frankserv, so it can be replayed into any frankserv collector port.
+type Recorder struct {
+	enc *gob.Encoder
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{gob.NewEncoder(w)}
+}
+
+func (r *Recorder) Record(s NamedSample) error {
+	return r.enc.Encode(s)
+}
+
+type Playback struct {
+	dec *gob.Decoder
+}
+
+func NewPlayback(r io.Reader) *Playback {
+	return &Playback{gob.NewDecoder(r)}
+}
+
+// Next returns the next recorded sample, or io.EOF at the end of the
+// recording.
+func (p *Playback) Next() (NamedSample, error) {
+	var s NamedSample
+	err := p.dec.Decode(&s)
+	return s, err
+}
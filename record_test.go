@@ -0,0 +1,32 @@
+package frank
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestRecordPlayback(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	r.Record(NamedSample{Sample{1410000000000, []float64{1, 2, 3}}, "C:n:ks.cf:Read", nil})
+	r.Record(NamedSample{Sample{1410000005000, []float64{4, 5, 6}}, "C:n:ks.cf:Read", nil})
+	p := NewPlayback(&buf)
+	first, err := p.Next()
+	if err != nil {
+		t.Fatalf("Next produced error: %s", err)
+	}
+	second, err := p.Next()
+	if err != nil {
+		t.Fatalf("Next produced error: %s", err)
+	}
+	if first.TimestampMS != 1410000000000 || second.Data[0] != 4 || second.Name != "C:n:ks.cf:Read" {
+		t.Errorf("Samples changed by recording : %v, %v", first, second)
+	}
+	if first.Data[0] != 1 {
+		t.Errorf("First sample overwritten by second : %v", first.Data)
+	}
+	if _, err := p.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF at end of recording, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package frank
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+)
+
+// An SLO is a latency objective such as "99% of writes under 10ms over 30
+// days": the share Objective of the events of the meters matching Meter
+// (path.Match on cluster:node:cf:op, all added together) must be no slower
+// than Threshold over Window. Both are durations such as 10ms and 720h.
+type SLO struct {
+	Name      string  `json:"name"`
+	Meter     string  `json:"meter"`
+	Objective float64 `json:"objective"`
+	Threshold string  `json:"threshold"`
+	Window    string  `json:"window"`
+}
+
+func (s SLO) durations() (time.Duration, time.Duration, error) {
+	threshold, err := time.ParseDuration(s.Threshold)
+	if err != nil || threshold <= 0 {
+		return 0, 0, fmt.Errorf("threshold must be a latency such as 10ms")
+	}
+	window, err := time.ParseDuration(s.Window)
+	if err != nil || window < time.Minute {
+		return 0, 0, fmt.Errorf("window must be a duration of at least 1m such as 720h")
+	}
+	return threshold, window, nil
+}
+
+func (s SLO) GetName() string {
+	return s.Name
+}
+
+func (s SLO) WithName(name string) SLO {
+	s.Name = name
+	return s
+}
+
+func (s SLO) Validate() error {
+	if err := ValidName("SLO", s.Name); err != nil {
+		return err
+	}
+	if _, err := path.Match(s.Meter, ""); err != nil || s.Meter == "" {
+		return fmt.Errorf("Invalid meter pattern %q", s.Meter)
+	}
+	if s.Objective <= 0 || s.Objective >= 1 {
+		return fmt.Errorf("objective must be a fraction between 0 and 1 such as 0.99")
+	}
+	_, _, err := s.durations()
+	return err
+}
+
+// SLOWindow is how an SLO fared over the last Window, from the samples
+// taken between FromMS and ToMS (unix milliseconds, 0 without any). Complete
+// is false when the stored samples do not reach back to the start of the
+// window, as when sample_threshold keeps less than it: the figures then
+// only cover FromMS to ToMS. BudgetRemaining is
+// the share of the error budget, the (1 - objective) of events allowed to
+// be slow, left unspent; it goes negative once the budget is overspent.
+// BurnRate is how many times faster than allowed the budget is being
+// spent: 1 spends exactly the budget over the SLO's window.
+type SLOWindow struct {
+	Window          string  `json:"window"`
+	FromMS          int64   `json:"from_ms"`
+	ToMS            int64   `json:"to_ms"`
+	Complete        bool    `json:"complete"`
+	Total           float64 `json:"total"`
+	Slow            float64 `json:"slow"`
+	Attainment      float64 `json:"attainment"`
+	BudgetRemaining float64 `json:"budget_remaining"`
+	BurnRate        float64 `json:"burn_rate"`
+}
+
+// An SLOReport covers the SLO's own window first, then the shorter windows
+// asked for. Events are compared with BoundUS, the upper bound from Labels
+// of the bucket holding the threshold: histograms cannot tell events apart
+// within a bucket.
+type SLOReport struct {
+	SLO
+	BoundUS float64     `json:"bound_us"`
+	Meters  []string    `json:"meters"`
+	Windows []SLOWindow `json:"windows"`
+}
+
+// DefaultBurnWindows are the windows reported besides the SLO's own, short
+// enough to catch a fast burn and long enough to tell a slow one from
+// noise.
+var DefaultBurnWindows = []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour}
+
+// WindowCounts adds up the events between consecutive raw samples of a
+// meter that both fall between start and end (unix milliseconds), so that
+// a meter first seen inside the window does not count its whole history,
+// and returns the first and last timestamps counted, 0 without any.
+func WindowCounts(dst []float64, raw []Sample, start, end int64) (int64, int64) {
+	var first, last int64
+	for x := 1; x < len(raw); x++ {
+		prev, cur := raw[x-1], raw[x]
+		if prev.TimestampMS < start || cur.TimestampMS > end {
+			continue
+		}
+		if first == 0 {
+			first = prev.TimestampMS
+		}
+		last = cur.TimestampMS
+		for y := range cur.Data {
+			if y < len(prev.Data) && y < len(dst) {
+				dst[y] += Events(cur.Data[y] - prev.Data[y])
+			}
+		}
+	}
+	return first, last
+}
+
+// EvaluateSLO reports how the meters fared against the SLO in the windows
+// ending at now (unix milliseconds).
+func EvaluateSLO(s SLO, meters []*Meter, now int64, windows []time.Duration) (SLOReport, error) {
+	threshold, window, err := s.durations()
+	if err != nil {
+		return SLOReport{}, err
+	}
+	bound := float64(threshold / time.Microsecond)
+	r := SLOReport{SLO: s, BoundUS: Labels[LabelIndex(bound)], Meters: make([]string, 0, len(meters))}
+	raws := make([][]Sample, len(meters))
+	for x, m := range meters {
+		r.Meters = append(r.Meters, m.Name)
+		raws[x], _ = m.Raw()
+	}
+	sort.Strings(r.Meters)
+	budget := 1 - s.Objective
+	for _, w := range append([]time.Duration{window}, windows...) {
+		start := now - int64(w/time.Millisecond)
+		data := make([]float64, len(Labels))
+		sw := SLOWindow{Window: w.String(), Attainment: 1, BudgetRemaining: 1}
+		for _, raw := range raws {
+			first, last := WindowCounts(data, raw, start, now)
+			if first > 0 && (sw.FromMS == 0 || first < sw.FromMS) {
+				sw.FromMS = first
+			}
+			if last > sw.ToMS {
+				sw.ToMS = last
+			}
+			if len(raw) > 0 && raw[0].TimestampMS <= start {
+				sw.Complete = true
+			}
+		}
+		sw.Total = Count(data)
+		if sw.Total > 0 {
+			slowShare := FractionAbove(data, bound)
+			sw.Slow = slowShare * sw.Total
+			sw.Attainment = 1 - slowShare
+			sw.BudgetRemaining = 1 - slowShare/budget
+			sw.BurnRate = slowShare / budget
+		}
+		r.Windows = append(r.Windows, sw)
+	}
+	return r, nil
+}
+
+// ReportSLO evaluates the named SLO against the meters it matches now.
+func (u *Utility) ReportSLO(name string, now time.Time, windows []time.Duration) (SLOReport, error) {
+	s, ok := u.SLOs.Get(name)
+	if !ok {
+		return SLOReport{}, fmt.Errorf("Unable to find SLO %q", name)
+	}
+	meters, err := u.MatchMeters(s.Meter)
+	if err != nil {
+		return SLOReport{}, err
+	}
+	return EvaluateSLO(s, meters, now.UnixNano()/1e6, windows)
+}
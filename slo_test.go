@@ -0,0 +1,92 @@
+package frank
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEvaluateSLO(t *testing.T) {
+	u := NewUtility()
+	fast, slow := LabelIndex(5000), LabelIndex(20000)
+	now := int64(1410000000000)
+	for _, node := range []string{"10.0.0.1", "10.0.0.2"} {
+		u.NewMeter("Prod", node, "Space1.Test1", "WriteLatency")
+		total := make([]float64, len(Labels))
+		// A minute apart over two hours; the last hour 2% of writes are slow.
+		for x := int64(120); x >= 0; x-- {
+			if x < 60 {
+				total[fast] += 49
+				total[slow] += 1
+			} else {
+				total[fast] += 50
+			}
+			u.AddSample("Prod", node, "Space1.Test1", "WriteLatency", Sample{TimestampMS: now - x*60000, Data: append([]float64{}, total...)})
+		}
+	}
+	if _, _, err := u.SLOs.Put("writes", SLO{Meter: "Prod:*:*:WriteLatency", Objective: 0.99, Threshold: "10ms", Window: "2h"}); err != nil {
+		t.Fatalf("Put produced error: %s", err)
+	}
+	r, err := u.ReportSLO("writes", time.Unix(0, now*1e6), []time.Duration{time.Hour, 10 * time.Minute, 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("ReportSLO produced error: %s", err)
+	}
+	if len(r.Meters) != 2 || len(r.Windows) != 4 || r.BoundUS != Labels[LabelIndex(10000)] {
+		t.Fatalf("Invalid report : %+v", r)
+	}
+	close := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	whole, hour := r.Windows[0], r.Windows[1]
+	if whole.Window != "2h0m0s" || whole.Total != 12000 || whole.Slow != 120 || !close(whole.Attainment, 0.99) || !close(whole.BudgetRemaining, 0) {
+		t.Errorf("Invalid window report : %+v", whole)
+	}
+	if hour.Total != 6000 || !close(hour.BurnRate, 2) || !close(hour.BudgetRemaining, -1) {
+		t.Errorf("Invalid hour report : %+v", hour)
+	}
+	if !whole.Complete || whole.FromMS != now-7200000 || whole.ToMS != now {
+		t.Errorf("Invalid window coverage : %+v", whole)
+	}
+	// Only two hours are stored, so a day cannot be covered.
+	if day := r.Windows[3]; day.Complete || day.FromMS != now-7200000 || day.Total != 12000 {
+		t.Errorf("Invalid day coverage : %+v", day)
+	}
+	u.SLOs.Put("reads", SLO{Meter: "Prod:*:*:ReadLatency", Objective: 0.99, Threshold: "10ms", Window: "1h"})
+	if r, _ := u.ReportSLO("reads", time.Unix(0, now*1e6), nil); r.Windows[0].Complete || r.Windows[0].FromMS != 0 || r.Windows[0].Total != 0 {
+		t.Errorf("Invalid report without samples : %+v", r.Windows[0])
+	}
+
+	for _, s := range []SLO{
+		{Name: "x", Meter: "*", Objective: 1, Threshold: "10ms", Window: "1h"},
+		{Name: "x", Meter: "*", Objective: 0.9, Threshold: "fast", Window: "1h"},
+		{Name: "x/y", Meter: "*", Objective: 0.9, Threshold: "10ms", Window: "1h"},
+		{Name: "x", Meter: "[", Objective: 0.9, Threshold: "10ms", Window: "1h"},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("%+v should not be valid", s)
+		}
+	}
+}
+
+func TestSLOPersistence(t *testing.T) {
+	c := DefaultUtilityConfig()
+	c.SaveFile = filepath.Join(t.TempDir(), "frank.sav")
+	u := NewUtilityWithConfig(c)
+	u.SLOs.Put("reads", SLO{Meter: "*:ReadLatency", Objective: 0.999, Threshold: "5ms", Window: "720h"})
+	u.SLOs.Put("writes", SLO{Meter: "*:WriteLatency", Objective: 0.99, Threshold: "10ms", Window: "720h"})
+	if err := u.SLOs.Delete("reads"); err != nil {
+		t.Errorf("Delete produced error: %s", err)
+	}
+	if err := u.Save(); err != nil {
+		t.Fatalf("Save produced error: %s", err)
+	}
+	u2 := NewUtilityWithConfig(c)
+	if err := u2.Load(); err != nil {
+		t.Fatalf("Load produced error: %s", err)
+	}
+	if slos := u2.SLOs.All(); len(slos) != 1 || slos[0].Name != "writes" {
+		t.Errorf("Invalid SLOs after Load : %v", slos)
+	}
+	if _, err := u2.ReportSLO("reads", time.Now(), nil); err == nil {
+		t.Errorf("Reporting a deleted SLO should produce an error")
+	}
+}
@@ -0,0 +1,44 @@
+package frank
+
+// Percentile returns the upper bound, from Labels, of the bucket holding
+// the p-th percentile (0-100) of a histogram, or 0 if it is empty. The
+// overflow bucket reports math.MaxFloat64.
+func Percentile(data []float64, p float64) float64 {
+	total := Count(data)
+	if total <= 0 {
+		return 0
+	}
+	rank := total * p / 100
+	seen := 0.0
+	for x, v := range data {
+		seen += v
+		if seen >= rank && v > 0 {
+			return Labels[x]
+		}
+	}
+	return Labels[len(data)-1]
+}
+
+// Count returns the number of events in a histogram.
+func Count(data []float64) float64 {
+	total := 0.0
+	for _, v := range data {
+		total += v
+	}
+	return total
+}
+
+// FractionAbove returns the share (0-1) of a histogram's events in buckets
+// entirely slower than bound, that is above the bucket holding bound, or 0
+// if it is empty.
+func FractionAbove(data []float64, bound float64) float64 {
+	total := Count(data)
+	if total <= 0 {
+		return 0
+	}
+	above := 0.0
+	for x := LabelIndex(bound) + 1; x < len(data); x++ {
+		above += data[x]
+	}
+	return above / total
+}
@@ -0,0 +1,36 @@
+package frank
+
+import "testing"
+
+func TestPercentile(t *testing.T) {
+	data := make([]float64, len(Labels))
+	data[10] = 90
+	data[20] = 9
+	data[30] = 1
+	for p, want := range map[float64]float64{50: Labels[10], 90: Labels[10], 99: Labels[20], 100: Labels[30]} {
+		if got := Percentile(data, p); got != want {
+			t.Errorf("Percentile(%f) is %f, should be %f", p, got, want)
+		}
+	}
+	if got := Percentile(make([]float64, len(Labels)), 99); got != 0 {
+		t.Errorf("Percentile of empty histogram is %f, should be 0", got)
+	}
+	if Count(data) != 100 {
+		t.Errorf("Invalid Count : %f, should be 100", Count(data))
+	}
+}
+
+func TestFractionAbove(t *testing.T) {
+	data := make([]float64, len(Labels))
+	data[10] = 90
+	data[20] = 9
+	data[30] = 1
+	for bound, want := range map[float64]float64{Labels[10]: 0.1, Labels[20]: 0.01, Labels[20] + 1: 0.01, Labels[30]: 0} {
+		if got := FractionAbove(data, bound); got != want {
+			t.Errorf("FractionAbove(%f) is %f, should be %f", bound, got, want)
+		}
+	}
+	if got := FractionAbove(make([]float64, len(Labels)), 1); got != 0 {
+		t.Errorf("FractionAbove of empty histogram is %f, should be 0", got)
+	}
+}
@@ -0,0 +1,103 @@
+package frank
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidName checks the name of a kind of value, such as an SLO or a
+// dashboard, that is addressed over HTTP as /<kind>s/{name}.
+func ValidName(kind, name string) error {
+	if name == "" || strings.ContainsAny(name, "/?#") {
+		return fmt.Errorf("Invalid %s name %q: it may not be empty or contain '/', '?' or '#'", kind, name)
+	}
+	return nil
+}
+
+// Named is what a Store keeps: values that carry their own name and can be
+// checked before they are stored.
+type Named[T any] interface {
+	GetName() string
+	WithName(name string) T
+	Validate() error
+}
+
+// A Store keeps the values of one kind by name, guarded by the Utility's
+// mu, and saves them sorted by name to the <save_file>.<suffix> sidecar.
+type Store[T Named[T]] struct {
+	u      *Utility
+	kind   string
+	suffix string
+	items  map[string]T
+}
+
+func newStore[T Named[T]](u *Utility, kind, suffix string) *Store[T] {
+	return &Store[T]{u, kind, suffix, make(map[string]T)}
+}
+
+// Kind names what the store keeps, such as "SLO", for messages.
+func (s *Store[T]) Kind() string {
+	return s.kind
+}
+
+// Put validates v under name and adds it, or replaces the value of the same
+// name. It returns the stored value and whether it is new.
+func (s *Store[T]) Put(name string, v T) (T, bool, error) {
+	v = v.WithName(name)
+	if err := v.Validate(); err != nil {
+		return v, false, err
+	}
+	s.u.mu.Lock()
+	defer s.u.mu.Unlock()
+	_, existed := s.items[name]
+	s.items[name] = v
+	return v, !existed, nil
+}
+
+func (s *Store[T]) Get(name string) (T, bool) {
+	s.u.mu.RLock()
+	defer s.u.mu.RUnlock()
+	v, ok := s.items[name]
+	return v, ok
+}
+
+// All returns every value by name.
+func (s *Store[T]) All() []T {
+	s.u.mu.RLock()
+	defer s.u.mu.RUnlock()
+	ret := make([]T, 0, len(s.items))
+	for _, v := range s.items {
+		ret = append(ret, v)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].GetName() < ret[j].GetName() })
+	return ret
+}
+
+func (s *Store[T]) Delete(name string) error {
+	s.u.mu.Lock()
+	defer s.u.mu.Unlock()
+	if _, ok := s.items[name]; !ok {
+		return fmt.Errorf("Unable to find %s %q", s.kind, name)
+	}
+	delete(s.items, name)
+	return nil
+}
+
+func (s *Store[T]) save() error {
+	return s.u.saveSidecar(s.suffix, s.All())
+}
+
+func (s *Store[T]) load() error {
+	var loaded []T
+	if err := s.u.loadSidecar(s.suffix, &loaded); err != nil {
+		return err
+	}
+	s.u.mu.Lock()
+	defer s.u.mu.Unlock()
+	s.items = make(map[string]T)
+	for _, v := range loaded {
+		s.items[v.GetName()] = v
+	}
+	return nil
+}
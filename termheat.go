@@ -0,0 +1,202 @@
+package frank
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+type HeatmapOptions struct {
+	Height int           // most bucket rows to draw, 0 for one row per bucket
+	Width  int           // most time columns to draw, keeping the newest, 0 for all
+	Color  bool          // ANSI 256 color cells rather than ASCII shading
+	Marks  []HeatmapMark // drawn under the time axis
+	// Normalize scales the cells, after merging buckets into rows, by one of
+	// Normalizations. Only cells above 0 are shaded, so zscore shows
+	// intervals busier than usual.
+	Normalize string
+}
+
+// A HeatmapMark flags the column of the interval holding TimestampMS with
+// Symbol. Marks with a Label are also listed under the heatmap.
+type HeatmapMark struct {
+	TimestampMS int64
+	Symbol      byte
+	Label       string
+}
+
+// ClearScreen moves the cursor home and clears an ANSI terminal, for
+// redrawing a heatmap in place.
+const ClearScreen = "\x1b[H\x1b[2J"
+
+var (
+	heatShades = []string{" ", ".", ":", "-", "=", "+", "*", "#", "%", "@"}
+	// The same white to dark red scale as play.html.
+	heatColors = []int{231, 230, 229, 222, 215, 209, 203, 160, 124, 88}
+)
+
+// FormatLatency formats a Labels bound in microseconds for display.
+func FormatLatency(v float64) string {
+	switch {
+	case v == math.MaxFloat64:
+		return "higher"
+	case v >= 1e6:
+		return fmt.Sprintf("%.1fs", v/1e6)
+	case v >= 1e3:
+		return fmt.Sprintf("%.1fms", v/1e3)
+	}
+	return fmt.Sprintf("%.0fus", v)
+}
+
+type heatRow struct {
+	label string
+	cells []float64
+}
+
+// heatRows sums the buckets of aligned, diffed samples into at most height
+// rows, slowest first, covering only the buckets that saw any events.
+func heatRows(samples []Sample, height int) []heatRow {
+	lo, hi := len(Labels), -1
+	for _, s := range samples {
+		for y, v := range s.Data {
+			if v > 0 {
+				if y < lo {
+					lo = y
+				}
+				if y > hi {
+					hi = y
+				}
+			}
+		}
+	}
+	if hi < 0 {
+		return nil
+	}
+	group := 1
+	if height > 0 {
+		group = (hi - lo + height) / height
+	}
+	ret := make([]heatRow, 0)
+	for top := hi; top >= lo; top -= group {
+		row := heatRow{FormatLatency(Labels[top]), make([]float64, len(samples))}
+		for y := top; y > top-group && y >= lo; y-- {
+			for x, s := range samples {
+				if s.Data[y] > 0 {
+					row.cells[x] += s.Data[y]
+				}
+			}
+		}
+		ret = append(ret, row)
+	}
+	return ret
+}
+
+// markColumn returns the column of the interval holding ts, or -1 when it
+// is outside the samples.
+func markColumn(samples []Sample, ts int64) int {
+	interval := int64(0)
+	if len(samples) > 1 {
+		interval = samples[1].TimestampMS - samples[0].TimestampMS
+	}
+	for x := len(samples) - 1; x >= 0; x-- {
+		if ts >= samples[x].TimestampMS {
+			if ts-samples[x].TimestampMS > interval {
+				return -1
+			}
+			return x
+		}
+	}
+	return -1
+}
+
+// RenderHeatmap draws aligned, diffed samples as a heatmap with latency
+// buckets on the y-axis and time on the x-axis, one column per sample.
+// Adjacent buckets are merged to fit opts.Height, each row labelled with
+// the upper bound of its slowest bucket.
+func RenderHeatmap(w io.Writer, samples []Sample, opts HeatmapOptions) error {
+	const labelWidth = 8
+	if opts.Width > 0 && len(samples) > opts.Width {
+		samples = samples[len(samples)-opts.Width:]
+	}
+	bw := bufio.NewWriter(w)
+	rows := heatRows(samples, opts.Height)
+	if len(rows) == 0 {
+		fmt.Fprintf(bw, "no events\n")
+		return bw.Flush()
+	}
+	cols := make([][]float64, len(samples))
+	for x := range cols {
+		cols[x] = make([]float64, len(rows))
+		for y, r := range rows {
+			cols[x][y] = r.cells[x]
+		}
+	}
+	if err := normalizeGrid(cols, opts.Normalize); err != nil {
+		return err
+	}
+	max := 0.0
+	for x, c := range cols {
+		for y, v := range c {
+			rows[y].cells[x] = v
+			max = math.Max(max, v)
+		}
+	}
+	for _, r := range rows {
+		fmt.Fprintf(bw, "%*s |", labelWidth, r.label)
+		for _, v := range r.cells {
+			shade := 0
+			if v > 0 {
+				shade = 1 + int(v/max*float64(len(heatShades)-2))
+			}
+			if opts.Color {
+				fmt.Fprintf(bw, "\x1b[48;5;%dm \x1b[0m", heatColors[shade])
+			} else {
+				fmt.Fprintf(bw, "%s", heatShades[shade])
+			}
+		}
+		fmt.Fprintf(bw, "\n")
+	}
+
+	// Time labels every 20 columns, under a tick on the axis.
+	axis := []byte(strings.Repeat("-", len(samples)))
+	times := []byte(strings.Repeat(" ", len(samples)+labelWidth))
+	for x := 0; x < len(samples); x += 20 {
+		axis[x] = '+'
+		label := time.Unix(samples[x].TimestampMS/1e3, 0).Format("15:04:05")
+		if x+len(label) <= len(times) {
+			copy(times[x:], label)
+		}
+	}
+	fmt.Fprintf(bw, "%*s +%s\n", labelWidth, "", axis)
+	labelled := make([]HeatmapMark, 0)
+	if len(opts.Marks) > 0 {
+		marks := []byte(strings.Repeat(" ", len(samples)))
+		for _, m := range opts.Marks {
+			if x := markColumn(samples, m.TimestampMS); x >= 0 {
+				marks[x] = m.Symbol
+				if m.Label != "" {
+					labelled = append(labelled, m)
+				}
+			}
+		}
+		fmt.Fprintf(bw, "%*s  %s\n", labelWidth, "", strings.TrimRight(string(marks), " "))
+	}
+	fmt.Fprintf(bw, "%*s  %s\n", labelWidth, "", strings.TrimRight(string(times), " "))
+	switch opts.Normalize {
+	case "fraction":
+		fmt.Fprintf(bw, "%*s  max %.1f%% of an interval per cell\n", labelWidth, "", max*100)
+	case "log":
+		fmt.Fprintf(bw, "%*s  max %.0f per cell, log scale\n", labelWidth, "", math.Pow(10, max)-1)
+	case "zscore":
+		fmt.Fprintf(bw, "%*s  max %.1f standard deviations above the usual per cell\n", labelWidth, "", max)
+	default:
+		fmt.Fprintf(bw, "%*s  max %.0f per cell\n", labelWidth, "", max)
+	}
+	for _, m := range labelled {
+		fmt.Fprintf(bw, "%*s  %c %s %s\n", labelWidth, "", m.Symbol, time.Unix(m.TimestampMS/1e3, 0).Format("15:04:05"), m.Label)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,101 @@
+package frank
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func heatSamples() []Sample {
+	ret := make([]Sample, 30)
+	for x := range ret {
+		ret[x].TimestampMS = 1410000000000 + int64(x)*5000
+		ret[x].Data = make([]float64, len(Labels))
+		ret[x].Data[10] = 100
+		ret[x].Data[49] = float64(x % 2)
+	}
+	return ret
+}
+
+func TestRenderHeatmap(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderHeatmap(&buf, heatSamples(), HeatmapOptions{}); err != nil {
+		t.Fatalf("RenderHeatmap produced error: %s", err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) != 40+3+1 {
+		t.Fatalf("Invalid line count : %d, should be one per bucket from 10 to 49 plus the axis", len(lines))
+	}
+	if lines[0] != "  17.1ms |"+strings.Repeat(" .", 15) {
+		t.Errorf("Invalid top row : %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[39], "    14us |@@@@") {
+		t.Errorf("Invalid bottom row : %q", lines[39])
+	}
+}
+
+func TestRenderHeatmapCollapse(t *testing.T) {
+	var buf bytes.Buffer
+	RenderHeatmap(&buf, heatSamples(), HeatmapOptions{Height: 10, Width: 20, Color: true})
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) != 10+3+1 {
+		t.Fatalf("Invalid line count : %d, should be 10 rows plus the axis", len(lines))
+	}
+	if strings.Count(lines[0], "\x1b[48;5;") != 20 {
+		t.Errorf("Invalid colored cells in %q, should be 20", lines[0])
+	}
+}
+
+func TestRenderHeatmapEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	RenderHeatmap(&buf, make([]Sample, 0), HeatmapOptions{})
+	if buf.String() != "no events\n" {
+		t.Errorf("Invalid empty heatmap : %q", buf.String())
+	}
+}
+
+func TestRenderHeatmapMarks(t *testing.T) {
+	samples := heatSamples()
+	var buf bytes.Buffer
+	marks := []HeatmapMark{
+		{samples[3].TimestampMS + 1000, '!', ""},
+		{samples[7].TimestampMS, '^', "deploy v2.3"},
+		{samples[0].TimestampMS - 1000, '^', "before the heatmap"},
+	}
+	if err := RenderHeatmap(&buf, samples, HeatmapOptions{Marks: marks}); err != nil {
+		t.Fatalf("RenderHeatmap produced error: %s", err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if got := lines[41]; got != strings.Repeat(" ", 10)+"   !   ^" {
+		t.Errorf("Invalid mark row : %q", got)
+	}
+	if got := lines[44]; !strings.HasSuffix(got, " deploy v2.3") || !strings.HasPrefix(got, strings.Repeat(" ", 10)+"^ ") {
+		t.Errorf("Invalid mark label : %q", got)
+	}
+	if len(lines) != 46 {
+		t.Errorf("Invalid line count : %d, marks outside the heatmap should be left out", len(lines))
+	}
+}
+
+func TestRenderHeatmapNormalize(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderHeatmap(&buf, heatSamples(), HeatmapOptions{Normalize: "log"}); err != nil {
+		t.Fatalf("RenderHeatmap produced error: %s", err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if lines[0] != "  17.1ms |"+strings.Repeat(" :", 15) || !strings.HasSuffix(lines[42], "max 100 per cell, log scale") {
+		t.Errorf("Invalid log heatmap : %q, %q", lines[0], lines[42])
+	}
+
+	// Bucket 10 never changes, so only the slow bucket stands out.
+	buf.Reset()
+	RenderHeatmap(&buf, heatSamples(), HeatmapOptions{Normalize: "zscore"})
+	lines = strings.Split(buf.String(), "\n")
+	if lines[0] != "  17.1ms |"+strings.Repeat(" @", 15) || strings.TrimSpace(lines[39]) != "14us |" {
+		t.Errorf("Invalid zscore heatmap : %q, %q", lines[0], lines[39])
+	}
+
+	if err := RenderHeatmap(&buf, heatSamples(), HeatmapOptions{Normalize: "sqrt"}); err == nil {
+		t.Errorf("An unknown normalization should produce an error")
+	}
+}
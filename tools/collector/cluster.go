@@ -0,0 +1,99 @@
+package main
+
+import (
+	"github.com/cmceniry/frank"
+	"github.com/gocql/gocql"
+)
+
+type NodeInfo = frank.NodeInfo
+
+// nodeName is the node part of a node's meter names: its host_id, which
+// outlives address changes, or its address when there is none.
+func nodeName(n NodeInfo) string {
+	if n.HostID != "" {
+		return n.HostID
+	}
+	return n.Address
+}
+
+type ClusterInfo struct {
+	dst            string
+	Name           string
+	Version        string
+	Modern         bool
+	Local          NodeInfo
+	Nodes          []NodeInfo
+	ColumnFamilies [][2]string
+}
+
+// clusterInfoSource is how the collector learns about a cluster. Tests
+// replace it to run without Cassandra.
+var clusterInfoSource = getClusterInfo
+
+func getClusterInfo(dst string) (*ClusterInfo, error) {
+	ret := &ClusterInfo{dst, "", "", false, NodeInfo{}, make([]NodeInfo, 0), make([][2]string, 0)}
+
+	cluster := gocql.NewCluster(dst)
+	cluster.Keyspace = "system"
+	cluster.Consistency = gocql.One
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var (
+		hostID gocql.UUID
+		rpc    string
+	)
+	err = session.Query("SELECT cluster_name, release_version, host_id, data_center, rack, rpc_address FROM local LIMIT 1").Scan(
+		&ret.Name, &ret.Version, &hostID, &ret.Local.Datacenter, &ret.Local.Rack, &rpc)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Modern, err = isModern(ret.Version); err != nil {
+		return nil, err
+	}
+	ret.Local.HostID = hostID.String()
+	ret.Local.Address = nodeAddress(rpc, dst)
+	ret.Nodes = append(ret.Nodes, ret.Local)
+
+	var peer string
+	iter := session.Query("SELECT peer, host_id, data_center, rack, rpc_address FROM peers").Iter()
+	for {
+		n := NodeInfo{}
+		if !iter.Scan(&peer, &hostID, &n.Datacenter, &n.Rack, &rpc) {
+			break
+		}
+		n.HostID = hostID.String()
+		n.Address = nodeAddress(rpc, peer)
+		ret.Nodes = append(ret.Nodes, n)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	var res1, res2 string
+	if ret.Modern {
+		iter = session.Query("SELECT keyspace_name, table_name FROM system_schema.tables").Iter()
+	} else {
+		iter = session.Query("SELECT keyspace_name, columnfamily_name FROM system.schema_columnfamilies").Iter()
+	}
+	for iter.Scan(&res1, &res2) {
+		ret.ColumnFamilies = append(ret.ColumnFamilies, [2]string{res1, res2})
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Nodes bound to the wildcard address advertise 0.0.0.0 as their rpc_address,
+// so fall back to the address we know them by.
+func nodeAddress(rpc, fallback string) string {
+	if rpc == "" || rpc == "0.0.0.0" || rpc == "::" {
+		return fallback
+	}
+	return rpc
+}
@@ -3,13 +3,12 @@ package main
 import (
 	"encoding/gob"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/cmceniry/frank"
-	"github.com/cmceniry/golokia"
 	"net"
 	"os"
 	"time"
-	"github.com/gocql/gocql"
 )
 
 var (
@@ -18,72 +17,11 @@ var (
 	ErrHistEleConvert  = errors.New("Did not convert element correctly")
 )
 
-var gclient *golokia.Client
-
-type ClusterInfo struct {
-	dst string
-	Name string
-	Nodes []string
-	ColumnFamilies [][2]string
-}
-
-func getClusterInfo(dst string) (*ClusterInfo, error) {
-  ret := &ClusterInfo{dst, "", make([]string, 0), make([][2]string, 0)}
-
-	// Name
-  cluster := gocql.NewCluster(dst)
-	cluster.ProtoVersion = 1
-	cluster.Keyspace = "system"
-	cluster.Consistency = gocql.One
-	session, err := cluster.CreateSession()
-	if err != nil {
-		return nil, err
-	}
-	defer session.Close()
-	q  := session.Query("SELECT cluster_name FROM local LIMIT 1")
-	if err != nil {
-		return nil, err
-	}
-	err = q.Scan(&ret.Name)
-	if err != nil {
-	  return nil, err
-	}
-
-  // Skipping host identification for now
-  var res1, res2 string
-  // iter := session.Query("SELECT host_id FROM local").Iter()
-	// for iter.Scan(&res1) {
-	// 	ret.Nodes = append(ret.Nodes, res1)
-	// }
-	// if err := iter.Close(); err != nil {
-	// 	return nil, err
-	// }
-	var iter *gocql.Iter
-
-  iter = session.Query("SELECT keyspace_name, columnfamily_name FROM schema_columnfamilies").Iter()
-	for iter.Scan(&res1, &res2) {
-		ret.ColumnFamilies = append(ret.ColumnFamilies, [2]string{res1, res2})
-	}
-	if err := iter.Close(); err != nil {
-		return nil, err
-	}
-
-	return ret, nil
-}
-
-func getHistogram(ks, cf, field string) ([]float64, error) {
-	bean := fmt.Sprintf("columnfamily=%s,keyspace=%s,type=ColumnFamilies", cf, ks)
-	lrlhm, err := gclient.GetAttr("org.apache.cassandra.db", bean, field)
-	if err != nil {
-		return nil, err
-	}
-	l, ok := lrlhm.([]interface{})
+func toFloats(val interface{}) ([]float64, error) {
+	l, ok := val.([]interface{})
 	if !ok {
 		return nil, ErrHistConvert
 	}
-	if len(l) != len(frank.Labels) {
-		return nil, ErrHistLenMismatch
-	}
 	ret := make([]float64, len(l))
 	for idx, val := range l {
 		if valF, ok := val.(float64); ok {
@@ -95,70 +33,159 @@ func getHistogram(ks, cf, field string) ([]float64, error) {
 	return ret, nil
 }
 
-func collect(ci *ClusterInfo, keyspace string, columnfamily string, operation string, sink chan frank.NamedSample) {
-	if res, err := getHistogram(keyspace, columnfamily, operation); err != nil {
-		fmt.Printf("Error in collector(%s,%s,%s): %s\n", keyspace, columnfamily, operation, err)
-	} else {
-		name := ci.Name + ":" + ci.dst + ":" + keyspace + "." + columnfamily + ":" + operation
-		select {
-		case sink <- frank.NamedSample{frank.Sample{time.Now().UnixNano()/1e6, res}, name}:
-			// Normal behavior
-		default:
-			// Otherwise, don't do anything with the data since we don't want to block
-		}
+func (n *nodeCollector) send(ci *ClusterInfo, scope string, operation string, res []float64, sink chan frank.NamedSample) {
+	name := ci.Name + ":" + nodeName(n.node) + ":" + scope + ":" + operation
+	node := n.node
+	select {
+	case sink <- frank.NamedSample{Sample: frank.Sample{TimestampMS: time.Now().UnixNano()/1e6, Data: res}, Name: name, Node: &node}:
+		// Normal behavior
+	default:
+		// Otherwise, don't do anything with the data since we don't want to block
 	}
 }
 
-func forward(src chan frank.NamedSample, dst string) {
+// waitClusterInfo retries getClusterInfo with a growing delay until the
+// target answers.
+func waitClusterInfo(dst string) *ClusterInfo {
+	delay := 5 * time.Second
 	for {
-		conn, err := net.Dial("tcp", dst)
-		if err != nil {
-			fmt.Printf("Error in forwawrder: %s\n", err)
-			time.Sleep(5 * time.Second)
-			continue
+		ci, err := clusterInfoSource(dst)
+		if err == nil {
+			return ci
+		}
+		fmt.Fprintf(os.Stderr, "Unable to get cluster info for %s, retrying in %s : %s\n", dst, delay, err)
+		time.Sleep(delay)
+		if delay < 5*time.Minute {
+			delay *= 2
 		}
-		defer conn.Close()
-		enc := gob.NewEncoder(conn)
-		pointsSent := 0
-		for {
-			err := enc.Encode(<-src)
+	}
+}
+
+var forwardRetry = 5 * time.Second
+
+// forward sends samples to the first of the centrals that accepts a
+// connection, in order. After failing over to a standby it goes back to
+// the primary once failback has passed, and a sample whose send failed is
+// sent again on the next connection.
+func forward(src chan frank.NamedSample, centrals []string, failback time.Duration) {
+	var pending *frank.NamedSample
+	pointsSent := 0
+	for {
+		connected := false
+		for x, dst := range centrals {
+			conn, err := net.DialTimeout("tcp", dst, forwardRetry)
+			if err != nil {
+				fmt.Printf("Error in forwarder: %s\n", err)
+				continue
+			}
+			connected = true
+			var until <-chan time.Time
+			if x > 0 {
+				fmt.Printf("Failed over to %s\n", dst)
+				until = time.After(failback)
+			}
+			pending, err = sendSamples(conn, src, pending, until, &pointsSent)
+			conn.Close()
 			if err != nil {
-				fmt.Printf("Error in forwawrder: %s\n", err)
-				time.Sleep(5 * time.Second)
-				break
+				fmt.Printf("Error in forwarder: %s\n", err)
+				connected = false
 			}
-			pointsSent += 1
-			if pointsSent % 100 == 0 {
-				fmt.Printf("%d data points sent\n", pointsSent)
+			break
+		}
+		if !connected {
+			time.Sleep(forwardRetry)
+		}
+	}
+}
+
+// sendSamples streams samples to conn until a send fails or until fires.
+func sendSamples(conn net.Conn, src chan frank.NamedSample, pending *frank.NamedSample, until <-chan time.Time, pointsSent *int) (*frank.NamedSample, error) {
+	enc := gob.NewEncoder(conn)
+	for {
+		if pending == nil {
+			select {
+			case s := <-src:
+				pending = &s
+			case <-until:
+				return nil, nil
 			}
 		}
+		if err := enc.Encode(*pending); err != nil {
+			return pending, err
+		}
+		pending = nil
+		*pointsSent += 1
+		if *pointsSent % 100 == 0 {
+			fmt.Printf("%d data points sent\n", *pointsSent)
+		}
 	}
 }
 
 func main() {
-  if len(os.Args) != 3 {
-    fmt.Fprintf(os.Stderr, "Invalid command line : must specify target node (ip/name), and central (ip/name:port)")
-    os.Exit(-1)
-  }
-	target := os.Args[1]
-	central := os.Args[2]
-	gclient = golokia.NewClient(os.Args[1], "7025")
+	config := DefaultConfig()
+	configFile := flag.String("config", "", "path to YAML config file")
+	central := flag.String("central", "", "frankserv collector address (ip/name:port), or several separated by commas to fail over in order")
+	interval := flag.Duration("interval", config.Interval, "collection interval")
+	validateOnly := flag.Bool("validate", false, "check connectivity, list the meters that would be collected and exit")
+	discover := flag.Bool("discover", config.Discover, "discover and collect from every node in the targets' clusters")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [target central]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-	ci, err := getClusterInfo(target)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to get cluster info : %s\n", err)
+	if *configFile != "" {
+		if err := config.LoadFile(*configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(-1)
+		}
+	}
+	switch flag.NArg() {
+	case 0:
+	case 2:
+		config.Targets = append(config.Targets, Target{Host: flag.Arg(0)})
+		config.Central = flag.Arg(1)
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid command line : must specify target node (ip/name), and central (ip/name:port), or -config\n")
+		os.Exit(-1)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "central":
+			config.Central = *central
+		case "interval":
+			config.Interval = *interval
+		case "discover":
+			config.Discover = *discover
+		}
+	})
+	config.fillTargets()
+	if err := config.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration : %s\n", err)
+		os.Exit(-1)
+	}
+
+	if *validateOnly {
+		if !validate(&config) {
+			os.Exit(1)
+		}
+		return
 	}
 
 	stream := make(chan frank.NamedSample)
-	go func() {
-		for _ = range time.Tick(5 * time.Second) {
-			for _, cf := range ci.ColumnFamilies {
-				collect(ci, cf[0], cf[1], "LifetimeWriteLatencyHistogramMicros", stream)
-				collect(ci, cf[0], cf[1], "LifetimeReadLatencyHistogramMicros", stream)
-			}
+	if config.Discover {
+		go newTopology(&config, stream).run()
+	} else {
+		for _, target := range config.Targets {
+			go func(target Target) {
+				ci := waitClusterInfo(target.Host)
+				node := ci.Local
+				node.Address = target.Host
+				newNodeCollector(&config, target, node, ci).run(stream)
+			}(target)
 		}
-	}()
-	go forward(stream, central)
+	}
+	go forward(stream, config.Centrals(), config.Failback)
 
 	for {
 		time.Sleep(100 * time.Second)
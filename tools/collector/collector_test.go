@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/gob"
+	"github.com/cmceniry/frank"
+	"github.com/cmceniry/frank/jolokiatest"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const legacyBean = "columnfamily=Test1,keyspace=Space1,type=ColumnFamilies"
+
+func testConfig(j *jolokiatest.Server) *Config {
+	c := DefaultConfig()
+	c.Central = "127.0.0.1:0"
+	c.Interval = 20 * time.Millisecond
+	c.Targets = []Target{{j.Host(), j.Port(), j.Path}}
+	c.Exclude = []string{"system.*"}
+	return &c
+}
+
+func testClusterInfo(host string, modern bool, nodes ...NodeInfo) *ClusterInfo {
+	local := NodeInfo{HostID: "11111111-1111-1111-1111-111111111111", Address: host, Datacenter: "dc1", Rack: "rack1"}
+	return &ClusterInfo{
+		host,
+		"TestCluster",
+		map[bool]string{false: "2.0.17", true: "3.11.4"}[modern],
+		modern,
+		local,
+		append([]NodeInfo{local}, nodes...),
+		[][2]string{{"Space1", "Test1"}, {"system", "local"}},
+	}
+}
+
+func TestConfigWanted(t *testing.T) {
+	c := DefaultConfig()
+	c.Include = []string{"Space*"}
+	c.Exclude = []string{"*.Secret"}
+	for name, want := range map[[2]string]bool{
+		{"Space1", "Test1"}:  true,
+		{"Space1", "Secret"}: false,
+		{"system", "local"}:  false,
+	} {
+		if got := c.Wanted(name[0], name[1]); got != want {
+			t.Errorf("Wanted(%s.%s) is %t, should be %t", name[0], name[1], got, want)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	c := DefaultConfig()
+	c.Central = "localhost:4271"
+	c.Targets = []Target{{Host: "localhost"}}
+	c.fillTargets()
+	if err := c.Validate(); err != nil {
+		t.Errorf("Config should be valid: %s", err)
+	}
+	c.Sources = []string{"nope"}
+	if err := c.Validate(); err == nil {
+		t.Errorf("Unknown source should not be valid")
+	}
+	c.Sources = []string{"table"}
+	c.Central = "primary:4271, standby:4271"
+	if got := c.Centrals(); len(got) != 2 || got[1] != "standby:4271" {
+		t.Errorf("Invalid centrals : %q", got)
+	}
+	c.Central = "primary:4271,standby"
+	if err := c.Validate(); err == nil {
+		t.Errorf("Central without a port should not be valid")
+	}
+}
+
+func TestForwardFailover(t *testing.T) {
+	defer func(d time.Duration) { forwardRetry = d }(forwardRetry)
+	forwardRetry = 20 * time.Millisecond
+	primary, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	primaryAddr := primary.Addr().String()
+	primary.Close()
+	standby, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	defer standby.Close()
+
+	stream := make(chan frank.NamedSample)
+	go forward(stream, []string{primaryAddr, standby.Addr().String()}, 100*time.Millisecond)
+	receive := func(ln net.Listener) string {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatalf("Unable to accept: %s", err)
+		}
+		defer conn.Close()
+		var res frank.NamedSample
+		if err := gob.NewDecoder(conn).Decode(&res); err != nil {
+			t.Fatalf("Unable to decode sample: %s", err)
+		}
+		return res.Name
+	}
+	go func() { stream <- frank.NamedSample{Name: "first"} }()
+	if name := receive(standby); name != "first" {
+		t.Errorf("Invalid sample on standby : %s", name)
+	}
+
+	// Once the primary is back the collector returns to it after failback.
+	primary, err = net.Listen("tcp", primaryAddr)
+	if err != nil {
+		t.Skipf("Unable to listen on %s again: %s", primaryAddr, err)
+	}
+	defer primary.Close()
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		stream <- frank.NamedSample{Name: "second"}
+	}()
+	if name := receive(primary); name != "second" {
+		t.Errorf("Invalid sample on primary : %s", name)
+	}
+}
+
+func TestLegacyHistogram(t *testing.T) {
+	j := jolokiatest.NewServer("/jolokia")
+	defer j.Close()
+	j.SetFunc("org.apache.cassandra.db", legacyBean, "LifetimeWriteLatencyHistogramMicros",
+		jolokiatest.Histogram(91, func(x int) float64 { return float64(x) }, false))
+	c := testConfig(j)
+	c.Attributes = c.Attributes[:1]
+	ci := testClusterInfo(j.Host(), false)
+	n := newNodeCollector(c, c.Targets[0], ci.Local, ci)
+
+	meters := n.meters(ci)
+	if len(meters) != 1 {
+		t.Fatalf("Invalid meters : %d, should be 1", len(meters))
+	}
+	for x := 1; x <= 2; x++ {
+		res, raw, err := meters[0].fetch()
+		if err != nil {
+			t.Fatalf("fetch produced error: %s", err)
+		}
+		if raw != 91 {
+			t.Errorf("Invalid raw bucket count : %d, should be 91", raw)
+		}
+		if res[10] != float64(10*x) {
+			t.Errorf("Invalid bucket value after %d reads : %f, should be %d", x, res[10], 10*x)
+		}
+	}
+}
+
+func TestModernHistogram(t *testing.T) {
+	j := jolokiatest.NewServer("/jolokia")
+	defer j.Close()
+	bean := "type=Table,keyspace=Space1,scope=Test1,name=ReadLatency"
+	j.SetFunc("org.apache.cassandra.metrics", bean, "RecentValues",
+		jolokiatest.Histogram(165, func(x int) float64 { return 1 }, true))
+	c := testConfig(j)
+	ci := testClusterInfo(j.Host(), true)
+	n := newNodeCollector(c, c.Targets[0], ci.Local, ci)
+
+	var res []float64
+	for x := 0; x < 3; x++ {
+		var (
+			raw int
+			err error
+		)
+		res, raw, err = n.getHistogram(ci, "Space1", "Test1", "LifetimeReadLatencyHistogramMicros")
+		if err != nil {
+			t.Fatalf("getHistogram produced error: %s", err)
+		}
+		if raw != 165 {
+			t.Errorf("Invalid raw bucket count : %d, should be 165", raw)
+		}
+	}
+	if len(res) != len(frank.Labels) {
+		t.Fatalf("Invalid length : %d, should be %d", len(res), len(frank.Labels))
+	}
+	if res[0] != 3 {
+		t.Errorf("RecentValues not accumulated : %f, should be 3", res[0])
+	}
+	if res[90] != 3*75 {
+		t.Errorf("Overflow buckets not folded : %f, should be %d", res[90], 3*75)
+	}
+}
+
+func TestValidateModern(t *testing.T) {
+	defer func(f func(string) (*ClusterInfo, error)) { clusterInfoSource = f }(clusterInfoSource)
+	j := jolokiatest.NewServer("/jolokia")
+	defer j.Close()
+	bean := "type=Table,keyspace=Space1,scope=Test1,name=ReadLatency"
+	j.SetFunc("org.apache.cassandra.metrics", bean, "RecentValues",
+		jolokiatest.Histogram(165, func(x int) float64 { return 1 }, true))
+	j.Set("org.apache.cassandra.metrics", bean, "Count", 42)
+	clusterInfoSource = func(dst string) (*ClusterInfo, error) { return testClusterInfo(dst, true), nil }
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	defer ln.Close()
+	c := testConfig(j)
+	c.Central = ln.Addr().String()
+	c.Attributes = []string{"LifetimeReadLatencyHistogramMicros"}
+	if !validate(c) {
+		t.Errorf("validate should pass")
+	}
+	if reads := j.Reads("org.apache.cassandra.metrics", bean, "RecentValues"); reads != 0 {
+		t.Errorf("validate read RecentValues %d times, should not read it", reads)
+	}
+}
+
+func TestTopology(t *testing.T) {
+	defer func(f func(string) (*ClusterInfo, error)) { clusterInfoSource = f }(clusterInfoSource)
+	peer := NodeInfo{HostID: "22222222-2222-2222-2222-222222222222", Address: "10.0.0.2", Datacenter: "dc1", Rack: "rack2"}
+	ci := testClusterInfo("10.0.0.1", false, peer)
+	clusterInfoSource = func(dst string) (*ClusterInfo, error) { return ci, nil }
+
+	c := DefaultConfig()
+	c.Interval = time.Hour
+	c.Targets = []Target{{Host: "10.0.0.1"}}
+	top := newTopology(&c, make(chan frank.NamedSample))
+	top.refresh()
+	if len(top.nodes) != 2 {
+		t.Fatalf("Invalid node count : %d, should be 2", len(top.nodes))
+	}
+	if top.nodes[peer.HostID].node.Address != "10.0.0.2" {
+		t.Errorf("Invalid peer address : %s, should be 10.0.0.2", top.nodes[peer.HostID].node.Address)
+	}
+
+	ci = testClusterInfo("10.0.0.1", false)
+	top.refresh()
+	if len(top.nodes) != 1 {
+		t.Errorf("Invalid node count after peer left : %d, should be 1", len(top.nodes))
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	defer func(f func(string) (*ClusterInfo, error)) { clusterInfoSource = f }(clusterInfoSource)
+	j := jolokiatest.NewServer("/jolokia")
+	defer j.Close()
+	j.SetFunc("org.apache.cassandra.db", legacyBean, "LifetimeWriteLatencyHistogramMicros",
+		jolokiatest.Histogram(91, func(x int) float64 { return float64(x % 3) }, false))
+	clusterInfoSource = func(dst string) (*ClusterInfo, error) { return testClusterInfo(dst, false), nil }
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	defer ln.Close()
+	c := testConfig(j)
+	c.Central = ln.Addr().String()
+	c.Attributes = c.Attributes[:1]
+
+	stream := make(chan frank.NamedSample)
+	node := NodeInfo{HostID: "11111111-1111-1111-1111-111111111111", Address: j.Host(), Datacenter: "dc1", Rack: "rack1"}
+	n := newNodeCollector(c, c.Targets[0], node, waitClusterInfo(j.Host()))
+	defer close(n.stop)
+	go n.run(stream)
+	go forward(stream, c.Centrals(), c.Failback)
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Unable to accept: %s", err)
+	}
+	defer conn.Close()
+	u := frank.NewUtility()
+	dec := gob.NewDecoder(conn)
+	for x := 0; x < 4; x++ {
+		var res frank.NamedSample
+		if err := dec.Decode(&res); err != nil {
+			t.Fatalf("Unable to decode sample: %s", err)
+		}
+		names := strings.Split(res.Name, ":")
+		if len(names) != 4 || names[1] != node.HostID || names[2] != "Space1.Test1" {
+			t.Fatalf("Invalid meter name : %s", res.Name)
+		}
+		if res.Node == nil || *res.Node != node {
+			t.Fatalf("Invalid node details : %+v", res.Node)
+		}
+		u.NewMeter(names[0], names[1], names[2], names[3])
+		u.AddSample(names[0], names[1], names[2], names[3], res.Sample)
+	}
+	m, err := u.GetMeter("TestCluster", node.HostID, "Space1.Test1", "LifetimeWriteLatencyHistogramMicros")
+	if err != nil {
+		t.Fatalf("Meter not found: %s", err)
+	}
+	raw, _ := m.Raw()
+	diff := frank.Diff(raw)
+	for _, d := range diff {
+		if d.Data[1] != 1 || d.Data[2] != 2 || d.Data[3] != 0 {
+			t.Errorf("Invalid diff : %v", d.Data[:4])
+		}
+	}
+}
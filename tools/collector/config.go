@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"path"
+	"strings"
+	"time"
+)
+
+type Target struct {
+	Host        string `yaml:"host"`
+	JolokiaPort int    `yaml:"jolokia_port"`
+	JolokiaPath string `yaml:"jolokia_path"`
+}
+
+type Config struct {
+	Central           string        `yaml:"central"`
+	Failback          time.Duration `yaml:"failback"`
+	Interval          time.Duration `yaml:"interval"`
+	JolokiaPort       int           `yaml:"jolokia_port"`
+	JolokiaPath       string        `yaml:"jolokia_path"`
+	Targets           []Target      `yaml:"targets"`
+	Attributes        []string      `yaml:"attributes"`
+	Include           []string      `yaml:"include"`
+	Exclude           []string      `yaml:"exclude"`
+	Sources           []string      `yaml:"sources"`
+	Discover          bool          `yaml:"discover"`
+	DiscoveryInterval time.Duration `yaml:"discovery_interval"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Interval:          5 * time.Second,
+		Failback:          5 * time.Minute,
+		JolokiaPort:       7025,
+		JolokiaPath:       "/jolokia",
+		DiscoveryInterval: 60 * time.Second,
+		Sources:           []string{"table"},
+		Attributes: []string{
+			"LifetimeWriteLatencyHistogramMicros",
+			"LifetimeReadLatencyHistogramMicros",
+		},
+	}
+}
+
+func (c *Config) LoadFile(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("Unable to read config file %s: %s", filename, err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("Unable to parse config file %s: %s", filename, err)
+	}
+	return nil
+}
+
+// Targets inherit the top level Jolokia port and path unless they set their own.
+func (c *Config) fillTargets() {
+	for x := range c.Targets {
+		if c.Targets[x].JolokiaPort == 0 {
+			c.Targets[x].JolokiaPort = c.JolokiaPort
+		}
+		if c.Targets[x].JolokiaPath == "" {
+			c.Targets[x].JolokiaPath = c.JolokiaPath
+		}
+	}
+}
+
+// Centrals returns the comma separated central addresses, primary first.
+func (c *Config) Centrals() []string {
+	ret := make([]string, 0)
+	for _, addr := range strings.Split(c.Central, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			ret = append(ret, addr)
+		}
+	}
+	return ret
+}
+
+func (c *Config) Validate() error {
+	if len(c.Centrals()) == 0 {
+		return fmt.Errorf("central must be set")
+	}
+	for _, addr := range c.Centrals() {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("central %q is not a host:port address", addr)
+		}
+	}
+	if len(c.Centrals()) > 1 && c.Failback <= 0 {
+		return fmt.Errorf("failback must be positive, got %s", c.Failback)
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", c.Interval)
+	}
+	if c.Discover && c.DiscoveryInterval <= 0 {
+		return fmt.Errorf("discovery_interval must be positive, got %s", c.DiscoveryInterval)
+	}
+	if len(c.Targets) == 0 {
+		return fmt.Errorf("at least one target must be set")
+	}
+	for _, t := range c.Targets {
+		if t.Host == "" {
+			return fmt.Errorf("target host must be set")
+		}
+		if t.JolokiaPort <= 0 || t.JolokiaPort > 65535 {
+			return fmt.Errorf("target %s: invalid jolokia_port %d", t.Host, t.JolokiaPort)
+		}
+	}
+	if len(c.Sources) == 0 {
+		return fmt.Errorf("at least one source must be set")
+	}
+	for _, name := range c.Sources {
+		if _, ok := catalog[name]; !ok && name != "table" {
+			return fmt.Errorf("unknown source %q", name)
+		}
+		if name == "table" && len(c.Attributes) == 0 {
+			return fmt.Errorf("at least one attribute must be set for the table source")
+		}
+	}
+	for _, p := range append(append([]string{}, c.Include...), c.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %s", p, err)
+		}
+	}
+	return nil
+}
+
+// Wanted reports whether keyspace.columnfamily passes the include and
+// exclude patterns. An empty include list matches everything.
+func (c *Config) Wanted(keyspace, columnfamily string) bool {
+	name := keyspace + "." + columnfamily
+	included := len(c.Include) == 0
+	for _, p := range c.Include {
+		if ok, _ := path.Match(p, name); ok {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, p := range c.Exclude {
+		if ok, _ := path.Match(p, name); ok {
+			return false
+		}
+	}
+	return true
+}
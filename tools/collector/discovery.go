@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"github.com/cmceniry/frank"
+	"time"
+)
+
+type seedView struct {
+	ci     *ClusterInfo
+	target Target
+}
+
+// topology treats every configured target as a seed, learns the members of
+// each seed's cluster from system.local and system.peers, and keeps one
+// nodeCollector running per host_id.
+type topology struct {
+	config *Config
+	sink   chan frank.NamedSample
+	views  []*seedView
+	nodes  map[string]*nodeCollector
+}
+
+func newTopology(config *Config, sink chan frank.NamedSample) *topology {
+	return &topology{
+		config,
+		sink,
+		make([]*seedView, len(config.Targets)),
+		make(map[string]*nodeCollector),
+	}
+}
+
+// Until some seed has answered, discovery is retried with a growing delay
+// rather than waiting out the full discovery interval.
+func (t *topology) run() {
+	delay := 5 * time.Second
+	for t.refresh(); len(t.nodes) == 0 && delay < t.config.DiscoveryInterval; t.refresh() {
+		fmt.Printf("No nodes discovered yet, retrying in %s\n", delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	for _ = range time.Tick(t.config.DiscoveryInterval) {
+		t.refresh()
+	}
+}
+
+// A seed that cannot be reached keeps its last known view so that a single
+// unreachable seed does not stop collection on the rest of its cluster.
+func (t *topology) refresh() {
+	for x, target := range t.config.Targets {
+		ci, err := clusterInfoSource(target.Host)
+		if err != nil {
+			fmt.Printf("Error discovering via %s: %s\n", target.Host, err)
+			continue
+		}
+		t.views[x] = &seedView{ci, target}
+	}
+
+	current := make(map[string]bool)
+	for _, v := range t.views {
+		if v == nil {
+			continue
+		}
+		for _, node := range v.ci.Nodes {
+			if current[node.HostID] {
+				continue
+			}
+			current[node.HostID] = true
+			t.update(node, v)
+		}
+	}
+
+	for hostID, n := range t.nodes {
+		if !current[hostID] {
+			fmt.Printf("Stopping collection on %s (%s) : left %s\n", n.node.Address, hostID, n.clusterInfo().Name)
+			close(n.stop)
+			delete(t.nodes, hostID)
+		}
+	}
+}
+
+func (t *topology) update(node NodeInfo, v *seedView) {
+	if n, ok := t.nodes[node.HostID]; ok {
+		if n.node == node {
+			n.setClusterInfo(v.ci)
+			return
+		}
+		fmt.Printf("Restarting collection on %s (%s) : was %s %s/%s\n", node.Address, node.HostID, n.node.Address, n.node.Datacenter, n.node.Rack)
+		close(n.stop)
+	} else {
+		fmt.Printf("Starting collection on %s (%s) in %s %s/%s\n", node.Address, node.HostID, v.ci.Name, node.Datacenter, node.Rack)
+	}
+	n := newNodeCollector(t.config, v.target, node, v.ci)
+	t.nodes[node.HostID] = n
+	go n.run(t.sink)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type jolokiaClient struct {
+	URL    string
+	client *http.Client
+}
+
+type jolokiaResponse struct {
+	Value  interface{} `json:"value"`
+	Status int         `json:"status"`
+	Error  string      `json:"error"`
+}
+
+func newJolokiaClient(host string, port int, path string) *jolokiaClient {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return &jolokiaClient{
+		fmt.Sprintf("http://%s:%d%s", host, port, strings.TrimRight(path, "/")),
+		&http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (j *jolokiaClient) GetAttr(domain, bean, attr string) (interface{}, error) {
+	resp, err := j.client.Get(fmt.Sprintf("%s/read/%s:%s/%s", j.URL, domain, bean, attr))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Jolokia returned HTTP %d for %s:%s/%s", resp.StatusCode, domain, bean, attr)
+	}
+	var res jolokiaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	if res.Status != http.StatusOK {
+		return nil, fmt.Errorf("Jolokia error %d for %s:%s/%s: %s", res.Status, domain, bean, attr, res.Error)
+	}
+	return res.Value, nil
+}
+
+func (j *jolokiaClient) Version() (string, error) {
+	resp, err := j.client.Get(j.URL + "/version")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Jolokia returned HTTP %d for %s/version", resp.StatusCode, j.URL)
+	}
+	var res jolokiaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("%s/version did not return Jolokia JSON: %s", j.URL, err)
+	}
+	if v, ok := res.Value.(map[string]interface{}); ok {
+		if agent, ok := v["agent"].(string); ok {
+			return agent, nil
+		}
+	}
+	return "", fmt.Errorf("%s/version did not report an agent version", j.URL)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"github.com/cmceniry/frank"
+	"sync"
+	"time"
+)
+
+type nodeCollector struct {
+	config  *Config
+	node    NodeInfo
+	jolokia *jolokiaClient
+	stop    chan struct{}
+	totals  map[string][]float64
+	warned  map[string]bool
+
+	mu sync.Mutex
+	ci *ClusterInfo
+}
+
+// The node is reached on its discovered address using the Jolokia settings of
+// the target it was found through.
+func newNodeCollector(config *Config, target Target, node NodeInfo, ci *ClusterInfo) *nodeCollector {
+	return &nodeCollector{
+		config:  config,
+		node:    node,
+		jolokia: newJolokiaClient(node.Address, target.JolokiaPort, target.JolokiaPath),
+		stop:    make(chan struct{}),
+		totals:  make(map[string][]float64),
+		warned:  make(map[string]bool),
+		ci:      ci,
+	}
+}
+
+func (n *nodeCollector) setClusterInfo(ci *ClusterInfo) {
+	n.mu.Lock()
+	n.ci = ci
+	n.mu.Unlock()
+}
+
+func (n *nodeCollector) clusterInfo() *ClusterInfo {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ci
+}
+
+func (n *nodeCollector) run(sink chan frank.NamedSample) {
+	ticker := time.NewTicker(n.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+		ci := n.clusterInfo()
+		for _, m := range n.meters(ci) {
+			if res, _, err := m.fetch(); err != nil {
+				fmt.Printf("Error in collector(%s,%s,%s): %s\n", n.node.Address, m.Scope, m.Op, err)
+			} else {
+				n.send(ci, m.Scope, m.Op, res, sink)
+			}
+		}
+	}
+}
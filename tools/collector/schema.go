@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"github.com/cmceniry/frank"
+	"strconv"
+	"strings"
+)
+
+// Cassandra 3.0 moved the schema into system_schema and dropped the
+// org.apache.cassandra.db ColumnFamilies beans in favor of the metrics
+// registry.
+func isModern(version string) (bool, error) {
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if err != nil {
+		return false, fmt.Errorf("Unable to parse release_version %q", version)
+	}
+	return major >= 3, nil
+}
+
+// Meters keep the legacy attribute names as their operation so that heatmaps
+// carry on across an upgrade.
+var modernTableMetrics = map[string]string{
+	"LifetimeWriteLatencyHistogramMicros": "WriteLatency",
+	"LifetimeReadLatencyHistogramMicros":  "ReadLatency",
+}
+
+// The histogram getters return the meter's data along with the number of
+// buckets Cassandra reported, which is 0 for gauges.
+func (n *nodeCollector) getHistogram(ci *ClusterInfo, ks, cf, field string) ([]float64, int, error) {
+	if ci.Modern {
+		return n.getModernHistogram(ks, cf, field)
+	}
+	return n.getLegacyHistogram(ks, cf, field)
+}
+
+func (n *nodeCollector) getLegacyHistogram(ks, cf, field string) ([]float64, int, error) {
+	bean := fmt.Sprintf("columnfamily=%s,keyspace=%s,type=ColumnFamilies", cf, ks)
+	lrlhm, err := n.jolokia.GetAttr("org.apache.cassandra.db", bean, field)
+	if err != nil {
+		return nil, 0, err
+	}
+	ret, err := toFloats(lrlhm)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(ret) != len(frank.Labels) {
+		return nil, len(ret), ErrHistLenMismatch
+	}
+	return ret, len(ret), nil
+}
+
+// checkHistogram confirms that a table meter can be read; see
+// checkRecentHistogram for Cassandra 3.0+.
+func (n *nodeCollector) checkHistogram(ci *ClusterInfo, ks, cf, field string) (string, error) {
+	if ci.Modern {
+		bean, err := modernTableBean(ks, cf, field)
+		if err != nil {
+			return "", err
+		}
+		return n.checkRecentHistogram(bean)
+	}
+	_, raw, err := n.getLegacyHistogram(ks, cf, field)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d buckets", raw), nil
+}
+
+func modernTableBean(ks, cf, field string) (string, error) {
+	name, ok := modernTableMetrics[field]
+	if !ok {
+		return "", fmt.Errorf("No Cassandra 3.0+ equivalent for %s", field)
+	}
+	return fmt.Sprintf("type=Table,keyspace=%s,scope=%s,name=%s", ks, cf, name), nil
+}
+
+func (n *nodeCollector) getModernHistogram(ks, cf, field string) ([]float64, int, error) {
+	bean, err := modernTableBean(ks, cf, field)
+	if err != nil {
+		return nil, 0, err
+	}
+	return n.getRecentHistogram(bean, ks+"."+cf+":"+field)
+}
+
+// The metrics registry histograms have more buckets than Labels (165 rather
+// than 91) and RecentValues only reports the counts since the previous read,
+// so they are folded onto Labels and accumulated here under key to give the
+// same lifetime totals the legacy beans did.
+func (n *nodeCollector) getRecentHistogram(bean, key string) ([]float64, int, error) {
+	val, err := n.jolokia.GetAttr("org.apache.cassandra.metrics", bean, "RecentValues")
+	if err != nil {
+		return nil, 0, err
+	}
+	raw, err := toFloats(val)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(raw) < 2 {
+		return nil, len(raw), ErrHistLenMismatch
+	}
+	res := frank.Rebucket(raw, frank.HistogramOffsets(len(raw)-1))
+	total := n.total(key)
+	for x := range total {
+		total[x] += res[x]
+	}
+	return append([]float64{}, total...), len(raw), nil
+}
+
+// checkRecentHistogram confirms that a metrics registry histogram exists
+// by reading its Count. Reading RecentValues would start a new window on
+// the node and take those events from the running collector.
+func (n *nodeCollector) checkRecentHistogram(bean string) (string, error) {
+	val, err := n.jolokia.GetAttr("org.apache.cassandra.metrics", bean, "Count")
+	if err != nil {
+		return "", err
+	}
+	count, ok := val.(float64)
+	if !ok {
+		return "", ErrHistConvert
+	}
+	return fmt.Sprintf("%.0f events", count), nil
+}
+
+// Gauges and counters have no buckets of their own, so each reading counts
+// once in the Labels bucket holding its value. Over time the meter shows how
+// often the value sat in each range.
+func (n *nodeCollector) getGauge(bean, attr, key string) ([]float64, int, error) {
+	val, err := n.jolokia.GetAttr("org.apache.cassandra.metrics", bean, attr)
+	if err != nil {
+		return nil, 0, err
+	}
+	valF, ok := val.(float64)
+	if !ok {
+		return nil, 0, ErrHistConvert
+	}
+	total := n.total(key)
+	total[frank.LabelIndex(valF)]++
+	return append([]float64{}, total...), 0, nil
+}
+
+func (n *nodeCollector) total(key string) []float64 {
+	total, ok := n.totals[key]
+	if !ok {
+		total = make([]float64, len(frank.Labels))
+		n.totals[key] = total
+	}
+	return total
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+)
+
+// A meterSpec is one meter produced by a metric source. Scope and Op become
+// the cf and op components of the meter name, so node level meters sit next
+// to the keyspace.columnfamily meters of the same node. Per table sources
+// use keyspace.columnfamily as the scope and fill %[1]s (keyspace) and %[2]s
+// (columnfamily) in Bean.
+type meterSpec struct {
+	Scope string
+	Op    string
+	Bean  string
+	Attr  string
+	Gauge bool
+}
+
+type metricSource struct {
+	PerTable bool
+	Meters   []meterSpec
+}
+
+func latency(scope, op, bean string) meterSpec {
+	return meterSpec{scope, op, bean, "RecentValues", false}
+}
+
+func gauge(scope, op, bean, attr string) meterSpec {
+	return meterSpec{scope, op, bean, attr, true}
+}
+
+func threadPoolMeters(pools [][2]string) []meterSpec {
+	ret := make([]meterSpec, 0, len(pools)*3)
+	for _, p := range pools {
+		scope := "ThreadPool." + p[1]
+		bean := fmt.Sprintf("type=ThreadPools,path=%s,scope=%s,name=", p[0], p[1])
+		ret = append(ret,
+			gauge(scope, "ActiveTasks", bean+"ActiveTasks", "Value"),
+			gauge(scope, "PendingTasks", bean+"PendingTasks", "Value"),
+			gauge(scope, "CurrentlyBlockedTasks", bean+"CurrentlyBlockedTasks", "Count"),
+		)
+	}
+	return ret
+}
+
+// "table" is not listed here: it is the original per table collection of the
+// configured attributes and works against every Cassandra version. All of
+// the catalog sources read the metrics registry and need Cassandra 3.0+.
+var catalog = map[string]metricSource{
+	"client_request": {false, []meterSpec{
+		latency("ClientRequest", "ReadLatency", "type=ClientRequest,scope=Read,name=Latency"),
+		latency("ClientRequest", "WriteLatency", "type=ClientRequest,scope=Write,name=Latency"),
+		latency("ClientRequest", "RangeSliceLatency", "type=ClientRequest,scope=RangeSlice,name=Latency"),
+		latency("ClientRequest", "CASReadLatency", "type=ClientRequest,scope=CASRead,name=Latency"),
+		latency("ClientRequest", "CASWriteLatency", "type=ClientRequest,scope=CASWrite,name=Latency"),
+	}},
+	"cross_node": {false, []meterSpec{
+		latency("Messaging", "CrossNodeLatency", "type=Messaging,name=CrossNodeLatency"),
+	}},
+	"compaction": {false, []meterSpec{
+		gauge("Compaction", "PendingTasks", "type=Compaction,name=PendingTasks", "Value"),
+		gauge("ThreadPool.CompactionExecutor", "ActiveTasks", "type=ThreadPools,path=internal,scope=CompactionExecutor,name=ActiveTasks", "Value"),
+	}},
+	"sstables_per_read": {true, []meterSpec{
+		latency("", "SSTablesPerReadHistogram", "type=Table,keyspace=%[1]s,scope=%[2]s,name=SSTablesPerReadHistogram"),
+	}},
+	"thread_pools": {false, threadPoolMeters([][2]string{
+		{"request", "ReadStage"},
+		{"request", "MutationStage"},
+		{"request", "CounterMutationStage"},
+		{"request", "RequestResponseStage"},
+		{"request", "ViewMutationStage"},
+		{"internal", "MemtableFlushWriter"},
+		{"internal", "GossipStage"},
+		{"internal", "Native-Transport-Requests"},
+	})},
+}
+
+// A meter's fetch reads its next sample. check confirms that it can be
+// read, and describes it, without disturbing what the running collector
+// will fetch.
+type meter struct {
+	Scope string
+	Op    string
+	fetch func() ([]float64, int, error)
+	check func() (string, error)
+}
+
+// meters lists everything the node collects for the configured sources.
+func (n *nodeCollector) meters(ci *ClusterInfo) []meter {
+	ret := make([]meter, 0)
+	for _, name := range n.config.Sources {
+		if name == "table" {
+			for _, cf := range ci.ColumnFamilies {
+				if !n.config.Wanted(cf[0], cf[1]) {
+					continue
+				}
+				for _, attr := range n.config.Attributes {
+					ks, table, attr := cf[0], cf[1], attr
+					ret = append(ret, meter{ks + "." + table, attr, func() ([]float64, int, error) {
+						return n.getHistogram(ci, ks, table, attr)
+					}, func() (string, error) {
+						return n.checkHistogram(ci, ks, table, attr)
+					}})
+				}
+			}
+			continue
+		}
+		src := catalog[name]
+		if !ci.Modern {
+			if !n.warned[name] {
+				fmt.Printf("Skipping %s on %s : needs Cassandra 3.0+, found %s\n", name, n.node.Address, ci.Version)
+				n.warned[name] = true
+			}
+			continue
+		}
+		if !src.PerTable {
+			for _, m := range src.Meters {
+				ret = append(ret, n.specMeter(m.Scope, m, m.Bean))
+			}
+			continue
+		}
+		for _, cf := range ci.ColumnFamilies {
+			if !n.config.Wanted(cf[0], cf[1]) {
+				continue
+			}
+			for _, m := range src.Meters {
+				ret = append(ret, n.specMeter(cf[0]+"."+cf[1], m, fmt.Sprintf(m.Bean, cf[0], cf[1])))
+			}
+		}
+	}
+	return ret
+}
+
+func (n *nodeCollector) specMeter(scope string, m meterSpec, bean string) meter {
+	key := scope + ":" + m.Op
+	return meter{scope, m.Op, func() ([]float64, int, error) {
+		if m.Gauge {
+			return n.getGauge(bean, m.Attr, key)
+		}
+		return n.getRecentHistogram(bean, key)
+	}, func() (string, error) {
+		if m.Gauge {
+			_, _, err := n.getGauge(bean, m.Attr, key)
+			return "gauge", err
+		}
+		return n.checkRecentHistogram(bean)
+	}}
+}
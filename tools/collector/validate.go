@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// validate checks everything the collector depends on without sending any
+// data, printing what it finds. It returns false if anything would keep the
+// collector from working.
+func validate(config *Config) bool {
+	ok := true
+	fail := func(format string, args ...interface{}) {
+		fmt.Printf("  FAIL "+format+"\n", args...)
+		ok = false
+	}
+
+	reachable := 0
+	for _, central := range config.Centrals() {
+		fmt.Printf("Central %s\n", central)
+		if conn, err := net.DialTimeout("tcp", central, 5*time.Second); err != nil {
+			fmt.Printf("  WARN unable to connect: %s\n", err)
+		} else {
+			conn.Close()
+			reachable++
+			fmt.Printf("  ok   accepting connections\n")
+		}
+	}
+	if reachable == 0 {
+		fail("no central is reachable\n       Check that frankserv is running and its collector_listen address is reachable from here.")
+	}
+
+	for _, target := range config.Targets {
+		fmt.Printf("Target %s\n", target.Host)
+		ci, err := clusterInfoSource(target.Host)
+		if err != nil {
+			fail("CQL: %s\n       Check that the native transport is enabled (start_native_transport) and port 9042 is reachable from here.", err)
+			continue
+		}
+		fmt.Printf("  ok   CQL: cluster %q, Cassandra %s, %d nodes, %d column families\n", ci.Name, ci.Version, len(ci.Nodes), len(ci.ColumnFamilies))
+
+		nodes := []NodeInfo{ci.Local}
+		nodes[0].Address = target.Host
+		if config.Discover {
+			nodes = ci.Nodes
+		}
+		for _, node := range nodes {
+			n := newNodeCollector(config, target, node, ci)
+			fmt.Printf("Node %s (%s %s/%s)\n", node.Address, node.HostID, node.Datacenter, node.Rack)
+			version, err := n.jolokia.Version()
+			if err != nil {
+				fail("Jolokia at %s: %s\n       Check that the Jolokia agent is loaded into Cassandra (-javaagent) and listening on port %d with path %s.", n.jolokia.URL, err, target.JolokiaPort, target.JolokiaPath)
+				continue
+			}
+			fmt.Printf("  ok   Jolokia %s at %s\n", version, n.jolokia.URL)
+			meters := n.meters(ci)
+			if len(meters) == 0 {
+				fail("no meters to collect\n       Check the sources, attributes and include/exclude patterns.")
+			}
+			for _, m := range meters {
+				name := ci.Name + ":" + nodeName(node) + ":" + m.Scope + ":" + m.Op
+				if desc, err := m.check(); err != nil {
+					fail("%s : %s", name, err)
+				} else {
+					fmt.Printf("  ok   %s : %s\n", name, desc)
+				}
+			}
+		}
+	}
+	return ok
+}
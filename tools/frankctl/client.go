@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/cmceniry/frank"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type client struct {
+	Server string
+	http   *http.Client
+}
+
+func newClient(server string) *client {
+	return &client{strings.TrimRight(server, "/"), &http.Client{Timeout: 30 * time.Second}}
+}
+
+func meterPath(m []string) string {
+	parts := make([]string, len(m))
+	for x, p := range m {
+		parts[x] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+func (c *client) do(method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	u := c.Server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func (c *client) getJSON(path string, query url.Values, v interface{}) error {
+	resp, err := c.do("GET", path, query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *client) Clusters() ([]string, error) {
+	var ret []string
+	err := c.getJSON("/clusters", nil, &ret)
+	return ret, err
+}
+
+// clusterInfo is the answer to /clusters/{cluster}. Hosts has the address,
+// datacenter and rack of the nodes named by host_id.
+type clusterInfo struct {
+	Nodes          []string                  `json:"nodes"`
+	ColumnFamilies []string                  `json:"columnfamilies"`
+	Hosts          map[string]frank.NodeInfo `json:"hosts"`
+}
+
+func (c *client) Cluster(name string) (clusterInfo, error) {
+	var ret clusterInfo
+	err := c.getJSON("/clusters/"+url.PathEscape(name), nil, &ret)
+	return ret, err
+}
+
+func (c *client) Meters(cluster string) ([]string, error) {
+	var ret []string
+	q := url.Values{}
+	if cluster != "" {
+		q.Set("cluster", cluster)
+	}
+	err := c.getJSON("/meters", q, &ret)
+	return ret, err
+}
+
+// Align fetches the diffed histograms of a meter (cluster, node, cf, op)
+// between start and end at the given interval.
+func (c *client) Align(m []string, start, end time.Time, interval time.Duration) ([]frank.Sample, error) {
+	var ret []frank.Sample
+	q := url.Values{}
+	q.Set("start", fmt.Sprintf("%d", start.Unix()))
+	q.Set("end", fmt.Sprintf("%d", end.Unix()))
+	q.Set("interval", fmt.Sprintf("%d", int64(interval/time.Second)))
+	err := c.getJSON("/align/"+meterPath(m), q, &ret)
+	return ret, err
+}
+
+// Anomalies scores the same intervals as Align against the server's
+// default baseline.
+func (c *client) Anomalies(m []string, start, end time.Time, interval time.Duration) ([]frank.Anomaly, error) {
+	var ret []frank.Anomaly
+	q := url.Values{}
+	q.Set("start", fmt.Sprintf("%d", start.Unix()))
+	q.Set("end", fmt.Sprintf("%d", end.Unix()))
+	q.Set("interval", fmt.Sprintf("%d", int64(interval/time.Second)))
+	err := c.getJSON("/anomalies/"+meterPath(m), q, &ret)
+	return ret, err
+}
+
+func (c *client) Raw(m []string, w io.Writer) error {
+	resp, err := c.do("GET", "/raw/"+meterPath(m), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Export writes the meters matching patterns in one of the frank export
+// formats. A zero start exports everything, a zero interval the raw samples.
+func (c *client) Export(patterns []string, format string, start, end time.Time, interval time.Duration, w io.Writer) error {
+	q := url.Values{"meter": patterns}
+	q.Set("format", format)
+	if !start.IsZero() {
+		q.Set("start", fmt.Sprintf("%d", start.Unix()))
+		q.Set("end", fmt.Sprintf("%d", end.Unix()))
+	}
+	if interval > 0 {
+		q.Set("interval", fmt.Sprintf("%d", int64(interval/time.Second)))
+	}
+	resp, err := c.do("GET", "/export", q, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+type alert struct {
+	Rule        string    `json:"rule"`
+	Meter       string    `json:"meter"`
+	State       string    `json:"state"`
+	Description string    `json:"description"`
+	Since       time.Time `json:"since"`
+}
+
+func (c *client) Alerts() ([]alert, error) {
+	var ret []alert
+	err := c.getJSON("/alerts", nil, &ret)
+	return ret, err
+}
+
+// Annotations lists the annotations of cluster, or of every cluster, that
+// apply to node and table between start and end.
+func (c *client) Annotations(cluster, node, table string, start, end time.Time) ([]frank.Annotation, error) {
+	var ret []frank.Annotation
+	q := url.Values{}
+	for k, v := range map[string]string{"cluster": cluster, "node": node, "table": table} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	q.Set("start", fmt.Sprintf("%d", start.Unix()))
+	q.Set("end", fmt.Sprintf("%d", end.Unix()))
+	err := c.getJSON("/annotations", q, &ret)
+	return ret, err
+}
+
+func (c *client) Annotate(a frank.Annotation) (frank.Annotation, error) {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return a, err
+	}
+	resp, err := c.do("POST", "/annotations", nil, bytes.NewReader(body))
+	if err != nil {
+		return a, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&a)
+	return a, err
+}
+
+func (c *client) DeleteAnnotation(id int64) error {
+	resp, err := c.do("DELETE", fmt.Sprintf("/annotations/%d", id), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *client) SLOs() ([]frank.SLO, error) {
+	var ret []frank.SLO
+	err := c.getJSON("/slos", nil, &ret)
+	return ret, err
+}
+
+func (c *client) SLOReport(name string) (frank.SLOReport, error) {
+	var ret frank.SLOReport
+	err := c.getJSON("/slos/"+url.PathEscape(name)+"/report", nil, &ret)
+	return ret, err
+}
+
+func (c *client) Dashboards() ([]frank.Dashboard, error) {
+	var ret []frank.Dashboard
+	err := c.getJSON("/dashboards", nil, &ret)
+	return ret, err
+}
+
+func (c *client) Delete(m []string) error {
+	resp, err := c.do("DELETE", "/meters/"+meterPath(m), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *client) Save() (string, error) {
+	resp, err := c.do("POST", "/save", nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	msg, err := ioutil.ReadAll(resp.Body)
+	return string(msg), err
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/cmceniry/frank"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usage = `Usage: frankctl [-server url] command [flags] [args]
+
+Commands:
+  clusters                          list clusters
+  cluster <cluster>                 list the nodes and column families of a cluster
+  meters [cluster]                  list meters
+  percentiles <cluster> <node> <cf> <op>
+                                    print percentiles per interval
+  heatmap [-tail] [-anomalies] [-normalize mode] <cluster> <node> <cf> <op>
+                                    draw a heatmap in the terminal
+  export [-o file] <cluster> <node> <cf> <op>
+                                    write the raw samples of a meter as JSON
+  export -format csv|csv-wide|jsonl|columnar [-o file] <pattern>...
+                                    write the meters matching cluster:node:cf:op
+                                    patterns for analysis
+  alerts                            list pending and firing alerts
+  dashboards                        list dashboards and the URL to view them
+  slos [name]                       report attainment, error budget and burn rate
+  annotate [-ago d] [-node n] [-table ks.cf] [-tags a,b] <cluster> <text>
+                                    mark a deploy, repair or incident
+  annotations [-since d] [cluster]  list annotations
+  unannotate <id>                   delete an annotation
+  delete <cluster> <node> <cf> <op> delete a meter
+  save                              have frankserv save its data now
+`
+
+type rangeFlags struct {
+	since    time.Duration
+	until    time.Duration
+	interval time.Duration
+}
+
+func (r *rangeFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&r.since, "since", 10*time.Minute, "start this long ago")
+	fs.DurationVar(&r.until, "until", 0, "end this long ago")
+	fs.DurationVar(&r.interval, "interval", 5*time.Second, "width of each interval, in whole seconds")
+}
+
+func (r *rangeFlags) bounds() (time.Time, time.Time, error) {
+	if r.interval < time.Second || r.interval%time.Second != 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("-interval must be a whole number of seconds")
+	}
+	if r.since <= r.until {
+		return time.Time{}, time.Time{}, fmt.Errorf("-since must be further back than -until")
+	}
+	now := time.Now()
+	return now.Add(-r.since), now.Add(-r.until), nil
+}
+
+// meterArgs accepts a meter either as four arguments or as one
+// cluster:node:cf:op name, as printed by the meters command.
+func meterArgs(args []string) ([]string, error) {
+	if len(args) == 1 {
+		args = strings.Split(args[0], ":")
+	}
+	if len(args) != 4 {
+		return nil, fmt.Errorf("a meter is <cluster> <node> <cf> <op> or cluster:node:cf:op")
+	}
+	return args, nil
+}
+
+// terminalOptions sizes the heatmap from $LINES and $COLUMNS when the shell
+// exports them, and uses color when writing to a terminal.
+func terminalOptions() frank.HeatmapOptions {
+	opts := frank.HeatmapOptions{Height: 40, Width: 110}
+	if v, err := strconv.Atoi(os.Getenv("LINES")); err == nil && v > 8 {
+		opts.Height = v - 6
+	}
+	if v, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && v > 20 {
+		opts.Width = v - 12
+	}
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		opts.Color = os.Getenv("TERM") != "dumb"
+	}
+	return opts
+}
+
+func run(c *client, cmd string, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	var r rangeFlags
+	switch cmd {
+	case "percentiles", "heatmap":
+		r.register(fs)
+	}
+	var ago time.Duration
+	var note frank.Annotation
+	tags := ""
+	if cmd == "annotate" {
+		fs.DurationVar(&ago, "ago", 0, "when it happened, this long ago")
+		fs.StringVar(&note.Node, "node", "", "only mark the heatmaps of this node")
+		fs.StringVar(&note.Table, "table", "", "only mark the heatmaps of this keyspace.columnfamily")
+		fs.StringVar(&tags, "tags", "", "comma separated tags, such as deploy")
+	}
+	var heat frank.HeatmapOptions
+	tail, anomalies := false, false
+	if cmd == "heatmap" {
+		heat = terminalOptions()
+		fs.IntVar(&heat.Height, "height", heat.Height, "most rows to draw, merging buckets to fit")
+		fs.IntVar(&heat.Width, "width", heat.Width, "most intervals to draw, keeping the newest")
+		fs.BoolVar(&heat.Color, "color", heat.Color, "draw with ANSI colors")
+		fs.BoolVar(&tail, "tail", false, "redraw every interval as new samples arrive")
+		fs.BoolVar(&anomalies, "anomalies", false, "mark intervals that differ from the meter's baseline with !")
+		fs.StringVar(&heat.Normalize, "normalize", "count", "shade by "+strings.Join(frank.Normalizations, ", "))
+	}
+	output, format := "", ""
+	var since, interval time.Duration
+	if cmd == "export" {
+		fs.StringVar(&output, "o", "", "write to this file instead of standard output")
+		fs.StringVar(&format, "format", "json", "json (the raw samples of one meter), "+strings.Join(frank.ExportFormats, ", "))
+		fs.DurationVar(&since, "since", 0, "only export samples newer than this, 0 for all")
+		fs.DurationVar(&interval, "interval", 0, "align and diff to this interval, 0 for the raw samples")
+	}
+	if cmd == "annotations" {
+		fs.DurationVar(&since, "since", 7*24*time.Hour, "list annotations newer than this")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+
+	switch cmd {
+	case "clusters":
+		clusters, err := c.Clusters()
+		if err != nil {
+			return err
+		}
+		for _, name := range clusters {
+			fmt.Fprintf(out, "%s\n", name)
+		}
+	case "cluster":
+		if len(args) != 1 {
+			return fmt.Errorf("cluster needs a cluster name")
+		}
+		info, err := c.Cluster(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "nodes:\n")
+		for _, n := range info.Nodes {
+			if h, ok := info.Hosts[n]; ok {
+				fmt.Fprintf(out, "  %s %s %s/%s\n", n, h.Address, h.Datacenter, h.Rack)
+			} else {
+				fmt.Fprintf(out, "  %s\n", n)
+			}
+		}
+		fmt.Fprintf(out, "columnfamilies:\n")
+		for _, cf := range info.ColumnFamilies {
+			fmt.Fprintf(out, "  %s\n", cf)
+		}
+	case "meters":
+		cluster := ""
+		if len(args) > 0 {
+			cluster = args[0]
+		}
+		meters, err := c.Meters(cluster)
+		if err != nil {
+			return err
+		}
+		for _, name := range meters {
+			fmt.Fprintf(out, "%s\n", name)
+		}
+	case "percentiles", "heatmap":
+		m, err := meterArgs(args)
+		if err != nil {
+			return err
+		}
+		for {
+			start, end, err := r.bounds()
+			if err != nil {
+				return err
+			}
+			samples, err := c.Align(m, start, end, r.interval)
+			if err != nil {
+				return err
+			}
+			if cmd == "percentiles" {
+				printPercentiles(out, samples)
+				return nil
+			}
+			notes, err := c.Annotations(m[0], m[1], m[2], start, end)
+			if err != nil {
+				return err
+			}
+			heat.Marks = heat.Marks[:0]
+			for _, a := range notes {
+				heat.Marks = append(heat.Marks, frank.HeatmapMark{TimestampMS: a.TimestampMS, Symbol: '^', Label: a.Text})
+			}
+			if anomalies {
+				found, err := c.Anomalies(m, start, end, r.interval)
+				if err != nil {
+					return err
+				}
+				for _, a := range found {
+					if a.Anomalous {
+						heat.Marks = append(heat.Marks, frank.HeatmapMark{TimestampMS: a.TimestampMS, Symbol: '!'})
+					}
+				}
+			}
+			if tail {
+				fmt.Fprintf(out, "%s%s\n", frank.ClearScreen, strings.Join(m, ":"))
+			}
+			if err := frank.RenderHeatmap(out, samples, heat); err != nil || !tail {
+				return err
+			}
+			time.Sleep(r.interval)
+		}
+	case "export":
+		var m []string
+		var err error
+		if format == "json" {
+			m, err = meterArgs(args)
+		} else if len(args) == 0 {
+			err = fmt.Errorf("export -format %s needs one or more meter names or patterns", format)
+		}
+		if err != nil {
+			return err
+		}
+		w := out
+		if output != "" {
+			fi, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer fi.Close()
+			w = fi
+		}
+		if format != "json" {
+			var start, end time.Time
+			if since > 0 {
+				end = time.Now()
+				start = end.Add(-since)
+			}
+			return c.Export(args, format, start, end, interval, w)
+		}
+		return c.Raw(m, w)
+	case "alerts":
+		alerts, err := c.Alerts()
+		if err != nil {
+			return err
+		}
+		for _, a := range alerts {
+			fmt.Fprintf(out, "%-8s %-20s %s since %s\n  %s\n", a.State, a.Rule, a.Meter, a.Since.Local().Format("15:04:05"), a.Description)
+		}
+	case "dashboards":
+		dashboards, err := c.Dashboards()
+		if err != nil {
+			return err
+		}
+		for _, d := range dashboards {
+			fmt.Fprintf(out, "%-20s %2d panels  %s/static/dashboard.html#%s\n", d.Name, len(d.Panels), c.Server, d.Name)
+		}
+	case "slos":
+		slos, err := c.SLOs()
+		if err != nil {
+			return err
+		}
+		for _, s := range slos {
+			if len(args) > 0 && s.Name != args[0] {
+				continue
+			}
+			r, err := c.SLOReport(s.Name)
+			if err != nil {
+				return err
+			}
+			printSLOReport(out, r)
+		}
+	case "annotate":
+		if len(args) < 2 {
+			return fmt.Errorf("annotate needs a cluster and a text")
+		}
+		note.Cluster, note.Text = args[0], strings.Join(args[1:], " ")
+		note.TimestampMS = time.Now().Add(-ago).UnixNano() / 1e6
+		if tags != "" {
+			note.Tags = strings.Split(tags, ",")
+		}
+		a, err := c.Annotate(note)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Added annotation %d\n", a.ID)
+	case "annotations":
+		cluster := ""
+		if len(args) > 0 {
+			cluster = args[0]
+		}
+		end := time.Now()
+		notes, err := c.Annotations(cluster, "", "", end.Add(-since), end)
+		if err != nil {
+			return err
+		}
+		for _, a := range notes {
+			scope := a.Cluster
+			if a.Node != "" {
+				scope += " node " + a.Node
+			}
+			if a.Table != "" {
+				scope += " table " + a.Table
+			}
+			fmt.Fprintf(out, "%-4d %s %s : %s\n", a.ID, time.Unix(a.TimestampMS/1e3, 0).Format("2006-01-02 15:04:05"), scope, a.Text)
+		}
+	case "unannotate":
+		if len(args) != 1 {
+			return fmt.Errorf("unannotate needs an annotation id")
+		}
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid annotation id %q", args[0])
+		}
+		return c.DeleteAnnotation(id)
+	case "delete":
+		m, err := meterArgs(args)
+		if err != nil {
+			return err
+		}
+		return c.Delete(m)
+	case "save":
+		msg, err := c.Save()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s", msg)
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	return nil
+}
+
+func main() {
+	server := os.Getenv("FRANK_SERVER")
+	if server == "" {
+		server = "http://localhost:4270"
+	}
+	flag.StringVar(&server, "server", server, "frankserv HTTP address (or FRANK_SERVER)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(-1)
+	}
+	if err := run(newClient(server), flag.Arg(0), flag.Args()[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "frankctl %s : %s\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cmceniry/frank"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testServer(t *testing.T, deleted *string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/clusters", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]string{"TestCluster"})
+	})
+	mux.HandleFunc("/clusters/TestCluster", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(clusterInfo{
+			Nodes:          []string{"1111", "2222"},
+			ColumnFamilies: []string{"Space1.Test1"},
+			Hosts:          map[string]frank.NodeInfo{"1111": {HostID: "1111", Address: "10.0.0.1", Datacenter: "dc1", Rack: "rack1"}},
+		})
+	})
+	mux.HandleFunc("/meters", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]string{"TestCluster:localhost:Space1.Test1:WriteLatency"})
+	})
+	mux.HandleFunc("/meters/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		*deleted = r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/align/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("interval") != "5" {
+			t.Errorf("Invalid interval : %s, should be 5", r.URL.Query().Get("interval"))
+		}
+		samples := make([]frank.Sample, 3)
+		for x := range samples {
+			samples[x].TimestampMS = time.Now().UnixNano()/1e6 - int64(3-x)*5000
+			samples[x].Data = make([]float64, len(frank.Labels))
+			samples[x].Data[20] = 99
+			samples[x].Data[40] = 1
+		}
+		json.NewEncoder(w).Encode(samples)
+	})
+	mux.HandleFunc("/anomalies/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]frank.Anomaly{{TimestampMS: time.Now().UnixNano()/1e6 - 10000, Scored: true, Anomalous: true}})
+	})
+	notes := make([]frank.Annotation, 0)
+	mux.HandleFunc("/annotations", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			var a frank.Annotation
+			json.NewDecoder(r.Body).Decode(&a)
+			a.ID = int64(len(notes) + 1)
+			notes = append(notes, a)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(a)
+			return
+		}
+		json.NewEncoder(w).Encode(notes)
+	})
+	mux.HandleFunc("/dashboards", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]frank.Dashboard{{Name: "writes", Panels: make([]frank.Panel, 2)}})
+	})
+	mux.HandleFunc("/slos", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]frank.SLO{{Name: "writes", Meter: "*:WriteLatency", Objective: 0.99, Threshold: "10ms", Window: "720h"}})
+	})
+	mux.HandleFunc("/slos/writes/report", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(frank.SLOReport{
+			SLO:     frank.SLO{Name: "writes", Meter: "*:WriteLatency", Objective: 0.99, Threshold: "10ms", Window: "720h"},
+			BoundUS: 10090,
+			Windows: []frank.SLOWindow{{Window: "720h0m0s", FromMS: 1410000000000, ToMS: 1410002400000, Total: 1000, Slow: 5, Attainment: 0.995, BudgetRemaining: 0.5, BurnRate: 0.5}},
+		})
+	})
+	mux.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		w.Write([]byte(q.Get("format") + " " + strings.Join(q["meter"], ",") + " " + q.Get("interval")))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestCommands(t *testing.T) {
+	deleted := ""
+	srv := testServer(t, &deleted)
+	defer srv.Close()
+	c := newClient(srv.URL)
+
+	var out bytes.Buffer
+	if err := run(c, "clusters", nil, &out); err != nil || out.String() != "TestCluster\n" {
+		t.Errorf("Invalid clusters output : %q, %v", out.String(), err)
+	}
+
+	out.Reset()
+	if err := run(c, "cluster", []string{"TestCluster"}, &out); err != nil || out.String() != "nodes:\n  1111 10.0.0.1 dc1/rack1\n  2222\ncolumnfamilies:\n  Space1.Test1\n" {
+		t.Errorf("Invalid cluster output : %q, %v", out.String(), err)
+	}
+
+	out.Reset()
+	if err := run(c, "percentiles", []string{"TestCluster:localhost:Space1.Test1:WriteLatency"}, &out); err != nil {
+		t.Fatalf("percentiles produced error: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Invalid percentiles output : %q", out.String())
+	}
+	if fields := strings.Fields(lines[1]); fields[1] != "100" || fields[2] != "86us" || fields[5] != "3.3ms" {
+		t.Errorf("Invalid percentiles row : %q", lines[1])
+	}
+
+	out.Reset()
+	if err := run(c, "heatmap", []string{"-color=false", "TestCluster", "localhost", "Space1.Test1", "WriteLatency"}, &out); err != nil {
+		t.Fatalf("heatmap produced error: %s", err)
+	}
+	if rows := strings.Split(out.String(), "\n"); !strings.HasSuffix(rows[0], "|...") || !strings.HasSuffix(rows[20], "|@@@") {
+		t.Errorf("Invalid heatmap : %q", out.String())
+	}
+
+	out.Reset()
+	if err := run(c, "heatmap", []string{"-color=false", "-anomalies", "TestCluster:localhost:Space1.Test1:WriteLatency"}, &out); err != nil {
+		t.Fatalf("heatmap -anomalies produced error: %s", err)
+	}
+	if rows := strings.Split(out.String(), "\n"); strings.TrimSpace(rows[22]) != "!" {
+		t.Errorf("Invalid anomaly marks : %q", out.String())
+	}
+
+	out.Reset()
+	if err := run(c, "heatmap", []string{"-color=false", "-normalize", "fraction", "TestCluster:localhost:Space1.Test1:WriteLatency"}, &out); err != nil || !strings.Contains(out.String(), "max 99.0% of an interval per cell") {
+		t.Errorf("Invalid normalized heatmap : %q, %v", out.String(), err)
+	}
+
+	out.Reset()
+	if err := run(c, "annotate", []string{"-ago", "10s", "-tags", "deploy", "TestCluster", "deploy", "v2.3"}, &out); err != nil || out.String() != "Added annotation 1\n" {
+		t.Errorf("Invalid annotate output : %q, %v", out.String(), err)
+	}
+	out.Reset()
+	if err := run(c, "heatmap", []string{"-color=false", "TestCluster:localhost:Space1.Test1:WriteLatency"}, &out); err != nil {
+		t.Fatalf("heatmap produced error: %s", err)
+	}
+	if rows := strings.Split(out.String(), "\n"); strings.TrimSpace(rows[22]) != "^" || !strings.HasSuffix(rows[25], "deploy v2.3") {
+		t.Errorf("Invalid annotation marks : %q", out.String())
+	}
+
+	if err := run(c, "delete", []string{"TestCluster", "localhost", "Space1.Test1", "WriteLatency"}, &out); err != nil {
+		t.Errorf("delete produced error: %s", err)
+	}
+	if deleted != "/meters/TestCluster/localhost/Space1.Test1/WriteLatency" {
+		t.Errorf("Invalid delete path : %s", deleted)
+	}
+
+	out.Reset()
+	if err := run(c, "export", []string{"-format", "csv", "-interval", "1m", "*:ReadLatency", "*:WriteLatency"}, &out); err != nil || out.String() != "csv *:ReadLatency,*:WriteLatency 60" {
+		t.Errorf("Invalid export : %q, %v", out.String(), err)
+	}
+
+	out.Reset()
+	if err := run(c, "dashboards", nil, &out); err != nil || !strings.HasSuffix(out.String(), " 2 panels  "+srv.URL+"/static/dashboard.html#writes\n") {
+		t.Errorf("Invalid dashboards output : %q, %v", out.String(), err)
+	}
+
+	out.Reset()
+	if err := run(c, "slos", nil, &out); err != nil {
+		t.Fatalf("slos produced error: %s", err)
+	}
+	if rows := strings.Split(out.String(), "\n"); len(rows) != 5 || strings.Join(strings.Fields(rows[2]), " ") != "720h0m0s 40m0s* 1000 99.500% 50.0% 0.50" {
+		t.Errorf("Invalid slos output : %q", out.String())
+	}
+
+	if err := run(c, "heatmap", []string{"too", "few"}, &out); err == nil {
+		t.Errorf("heatmap with a bad meter should produce an error")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"github.com/cmceniry/frank"
+	"io"
+	"time"
+)
+
+var percentiles = []float64{50, 90, 99, 99.9}
+
+func printPercentiles(w io.Writer, samples []frank.Sample) {
+	fmt.Fprintf(w, "%-8s %10s", "time", "count")
+	for _, p := range percentiles {
+		fmt.Fprintf(w, " %9s", fmt.Sprintf("p%g", p))
+	}
+	fmt.Fprintf(w, "\n")
+	for _, s := range samples {
+		fmt.Fprintf(w, "%-8s %10.0f", time.Unix(s.TimestampMS/1e3, 0).Format("15:04:05"), frank.Count(s.Data))
+		for _, p := range percentiles {
+			v := "-"
+			if frank.Count(s.Data) > 0 {
+				v = frank.FormatLatency(frank.Percentile(s.Data, p))
+			}
+			fmt.Fprintf(w, " %9s", v)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func printSLOReport(w io.Writer, r frank.SLOReport) {
+	fmt.Fprintf(w, "%s: %g%% of %s under %s (%s) over %s, %d meters\n",
+		r.Name, r.Objective*100, r.Meter, r.Threshold, frank.FormatLatency(r.BoundUS), r.Window, len(r.Meters))
+	fmt.Fprintf(w, "  %-10s %10s %12s %10s %9s %9s\n", "window", "covered", "events", "attained", "budget", "burn")
+	partial := false
+	for _, sw := range r.Windows {
+		covered := (time.Duration(sw.ToMS-sw.FromMS) * time.Millisecond).String()
+		if !sw.Complete {
+			covered += "*"
+			partial = true
+		}
+		fmt.Fprintf(w, "  %-10s %10s %12.0f %9.3f%% %8.1f%% %9.2f\n", sw.Window, covered, sw.Total, sw.Attainment*100, sw.BudgetRemaining*100, sw.BurnRate)
+	}
+	if partial {
+		fmt.Fprintf(w, "  * the stored samples do not reach back to the start of the window\n")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/gob"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+func main() {
+	var (
+		central      = flag.String("central", "localhost:4271", "frankserv collector address (ip/name:port)")
+		clusters     = flag.Int("clusters", 1, "number of clusters")
+		nodes        = flag.Int("nodes", 3, "nodes per cluster")
+		tables       = flag.Int("tables", 2, "tables per node")
+		interval     = flag.Duration("interval", 5*time.Second, "time between samples")
+		backfill     = flag.Duration("backfill", 0, "generate this much history as fast as possible before running in real time")
+		duration     = flag.Duration("duration", 0, "stop after this long in real time (0 runs forever)")
+		rate         = flag.Float64("rate", 200, "requests per second per table and operation")
+		dist         = flag.String("dist", "lognormal", "latency distribution: lognormal or bimodal")
+		median       = flag.Float64("median", 800, "median latency in microseconds")
+		sigma        = flag.Float64("sigma", 0.5, "lognormal shape")
+		slowMedian   = flag.Float64("slow-median", 20000, "median latency of the slow mode for bimodal")
+		mix          = flag.Float64("mix", 0.1, "fraction of requests in the slow mode for bimodal")
+		gcEvery      = flag.Duration("gc-every", 0, "time between GC pauses on each node (0 disables)")
+		gcDuration   = flag.Duration("gc-duration", 2*time.Second, "length of each GC pause")
+		gcPause      = flag.Float64("gc-pause", 200000, "latency added during a GC pause in microseconds")
+		restartEvery = flag.Duration("restart-every", 0, "mean time between restarts of each node, resetting its counters (0 disables)")
+		seed         = flag.Int64("seed", time.Now().UnixNano(), "random seed")
+	)
+	flag.Parse()
+
+	var d Distribution
+	switch *dist {
+	case "lognormal":
+		d = Lognormal{*median, *sigma}
+	case "bimodal":
+		d = Bimodal{Lognormal{*median, *sigma}, Lognormal{*slowMedian, *sigma}, *mix}
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid distribution %q : must be lognormal or bimodal\n", *dist)
+		os.Exit(-1)
+	}
+	if *gcEvery > 0 {
+		if *gcDuration >= *gcEvery {
+			fmt.Fprintf(os.Stderr, "Invalid GC pause : -gc-duration must be shorter than -gc-every\n")
+			os.Exit(-1)
+		}
+		d = GCPauses{d, *gcEvery, *gcDuration, *gcPause}
+	}
+	if *clusters <= 0 || *nodes <= 0 || *tables <= 0 || *interval <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid workload : clusters, nodes, tables and interval must be positive\n")
+		os.Exit(-1)
+	}
+	w := NewWorkload(*clusters, *nodes, *tables, d, *rate, *restartEvery, *seed)
+
+	conn, err := net.Dial("tcp", *central)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to connect to %s : %s\n", *central, err)
+		os.Exit(-1)
+	}
+	defer conn.Close()
+	enc := gob.NewEncoder(conn)
+	send := func(now time.Time) {
+		for _, s := range w.Step(now, *interval) {
+			if err := enc.Encode(s); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to send to %s : %s\n", *central, err)
+				os.Exit(-1)
+			}
+		}
+	}
+
+	start := time.Now()
+	for t := start.Add(-*backfill); t.Before(start); t = t.Add(*interval) {
+		send(t)
+	}
+	if *backfill > 0 {
+		fmt.Printf("Backfilled %s\n", *backfill)
+	}
+	for now := range time.Tick(*interval) {
+		send(now)
+		if *duration > 0 && now.Sub(start) >= *duration {
+			return
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"github.com/cmceniry/frank"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// A Distribution draws request latencies in microseconds. node lets a
+// distribution vary between nodes, such as GC pauses that do not line up.
+type Distribution interface {
+	Latency(r *rand.Rand, node string, t time.Time) float64
+}
+
+type Lognormal struct {
+	Median float64
+	Sigma  float64
+}
+
+func (d Lognormal) Latency(r *rand.Rand, node string, t time.Time) float64 {
+	return d.Median * math.Exp(d.Sigma*r.NormFloat64())
+}
+
+type Bimodal struct {
+	Fast Lognormal
+	Slow Lognormal
+	Mix  float64
+}
+
+func (d Bimodal) Latency(r *rand.Rand, node string, t time.Time) float64 {
+	if r.Float64() < d.Mix {
+		return d.Slow.Latency(r, node, t)
+	}
+	return d.Fast.Latency(r, node, t)
+}
+
+// GCPauses adds up to Pause microseconds to requests arriving during a
+// Duration long pause that happens on every node once per Every, at an
+// offset derived from the node name.
+type GCPauses struct {
+	Base     Distribution
+	Every    time.Duration
+	Duration time.Duration
+	Pause    float64
+}
+
+func (d GCPauses) Latency(r *rand.Rand, node string, t time.Time) float64 {
+	lat := d.Base.Latency(r, node, t)
+	h := fnv.New32a()
+	h.Write([]byte(node))
+	offset := time.Duration(h.Sum32()) % d.Every
+	if (time.Duration(t.UnixNano())+offset)%d.Every < d.Duration {
+		lat += r.Float64() * d.Pause
+	}
+	return lat
+}
+
+type meterState struct {
+	name  string
+	total []float64
+}
+
+type nodeState struct {
+	name   string
+	meters []*meterState
+}
+
+type Workload struct {
+	Dist         Distribution
+	Rate         float64
+	RestartEvery time.Duration
+	rand         *rand.Rand
+	nodes        []*nodeState
+}
+
+var ops = []string{"LifetimeReadLatencyHistogramMicros", "LifetimeWriteLatencyHistogramMicros"}
+
+func NewWorkload(clusters, nodes, tables int, dist Distribution, rate float64, restartEvery time.Duration, seed int64) *Workload {
+	w := &Workload{Dist: dist, Rate: rate, RestartEvery: restartEvery, rand: rand.New(rand.NewSource(seed))}
+	for c := 0; c < clusters; c++ {
+		for n := 0; n < nodes; n++ {
+			node := &nodeState{name: fmt.Sprintf("10.%d.%d.%d", c, n/250, n%250+1)}
+			for t := 0; t < tables; t++ {
+				for _, op := range ops {
+					node.meters = append(node.meters, &meterState{
+						fmt.Sprintf("SynthCluster%d:%s:Keyspace1.Table%d:%s", c, node.name, t, op),
+						make([]float64, len(frank.Labels)),
+					})
+				}
+			}
+			w.nodes = append(w.nodes, node)
+		}
+	}
+	return w
+}
+
+// Step advances every meter by interval ending at now and returns the new
+// cumulative samples. A node that restarts loses its counters and reports
+// nothing for that interval.
+func (w *Workload) Step(now time.Time, interval time.Duration) []frank.NamedSample {
+	ret := make([]frank.NamedSample, 0)
+	for _, n := range w.nodes {
+		if w.RestartEvery > 0 && w.rand.Float64() < float64(interval)/float64(w.RestartEvery) {
+			for _, m := range n.meters {
+				m.total = make([]float64, len(frank.Labels))
+			}
+			continue
+		}
+		for _, m := range n.meters {
+			count := int(w.Rate*interval.Seconds()*(0.9+0.2*w.rand.Float64()) + 0.5)
+			for x := 0; x < count; x++ {
+				at := now.Add(-time.Duration(w.rand.Int63n(int64(interval))))
+				m.total[frank.LabelIndex(w.Dist.Latency(w.rand, n.name, at))]++
+			}
+			ret = append(ret, frank.NamedSample{
+				Sample: frank.Sample{TimestampMS: now.UnixNano() / 1e6, Data: append([]float64{}, m.total...)},
+				Name:   m.name,
+			})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/cmceniry/frank"
+	"testing"
+	"time"
+)
+
+func TestWorkloadCumulative(t *testing.T) {
+	w := NewWorkload(2, 3, 4, Lognormal{800, 0.3}, 100, 0, 1)
+	now := time.Unix(1410000000, 0)
+	first := w.Step(now, 5*time.Second)
+	if len(first) != 2*3*4*len(ops) {
+		t.Fatalf("Invalid sample count : %d, should be %d", len(first), 2*3*4*len(ops))
+	}
+	second := w.Step(now.Add(5*time.Second), 5*time.Second)
+	for x := range first {
+		if first[x].Name != second[x].Name {
+			t.Fatalf("Meter order changed : %s versus %s", first[x].Name, second[x].Name)
+		}
+		total := 0.0
+		for y := range first[x].Data {
+			if second[x].Data[y] < first[x].Data[y] {
+				t.Errorf("%s bucket %d went backwards without a restart", first[x].Name, y)
+			}
+			total += second[x].Data[y] - first[x].Data[y]
+		}
+		if total < 450 || total > 550 {
+			t.Errorf("%s : %f requests in 5s, should be about 500", first[x].Name, total)
+		}
+	}
+	peak := 0
+	for y, v := range second[0].Data {
+		if v > second[0].Data[peak] {
+			peak = y
+		}
+	}
+	if frank.Labels[peak] < 500 || frank.Labels[peak] > 1200 {
+		t.Errorf("Peak bucket is %f, should be near the 800us median", frank.Labels[peak])
+	}
+}
+
+func TestWorkloadRestart(t *testing.T) {
+	w := NewWorkload(1, 1, 1, Lognormal{800, 0.3}, 100, time.Nanosecond, 1)
+	if res := w.Step(time.Now(), 5*time.Second); len(res) != 0 {
+		t.Errorf("Restarting node reported %d samples, should be 0", len(res))
+	}
+	for _, m := range w.nodes[0].meters {
+		for _, v := range m.total {
+			if v != 0 {
+				t.Fatalf("Counters not reset by restart")
+			}
+		}
+	}
+}
+
+func TestGCPauses(t *testing.T) {
+	d := GCPauses{Lognormal{100, 0}, time.Minute, 10 * time.Second, 1e6}
+	w := NewWorkload(1, 1, 1, d, 0, 0, 1)
+	slow := 0
+	start := time.Unix(1410000000, 0)
+	for x := 0; x < 60; x++ {
+		if d.Latency(w.rand, "node", start.Add(time.Duration(x)*time.Second)) > 100 {
+			slow++
+		}
+	}
+	if slow < 8 || slow > 10 {
+		t.Errorf("%d of 60 seconds were in a pause, should be about 10", slow)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/cmceniry/frank"
+	"os"
+	"sort"
+	"time"
+)
+
+// dump is one nodetool histograms file, taken at a point in time.
+type dump struct {
+	filename string
+	taken    time.Time
+	tables   []frank.NodetoolHistograms
+}
+
+func mergeSaves(u *frank.Utility, files []string, policy frank.MergePolicy) error {
+	for _, filename := range files {
+		fi, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		samples, dups, err := u.Merge(fi, policy)
+		fi.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+		fmt.Printf("%s : %d samples, %d duplicate timestamps\n", filename, samples, dups)
+	}
+	return nil
+}
+
+// importDumps turns nodetool dumps into meters of cluster:node. Each dump
+// holds the events since the one before it, as nodetool reports recent
+// values, so the dumps of a meter are summed in time order into the
+// cumulative samples frank stores, starting from zero one period before
+// the first.
+func importDumps(u *frank.Utility, cluster, node string, dumps []dump, period time.Duration, policy frank.MergePolicy) error {
+	sort.Slice(dumps, func(i, j int) bool { return dumps[i].taken.Before(dumps[j].taken) })
+	totals := make(map[string][]float64)
+	count := 0
+	for _, d := range dumps {
+		ts := d.taken.UnixNano() / 1e6
+		for _, t := range d.tables {
+			for op, data := range t.Ops {
+				name := fmt.Sprintf("%s:%s:%s.%s:%s", cluster, node, t.Keyspace, t.Table, op)
+				total, ok := totals[name]
+				if !ok {
+					total = make([]float64, len(frank.Labels))
+					start := frank.Sample{TimestampMS: ts - int64(period/time.Millisecond), Data: total}
+					if _, err := u.MergeSample(name, start, policy); err != nil {
+						return err
+					}
+				}
+				next := make([]float64, len(total))
+				for x := range total {
+					next[x] = total[x] + data[x]
+				}
+				totals[name] = next
+				if _, err := u.MergeSample(name, frank.Sample{TimestampMS: ts, Data: next}, policy); err != nil {
+					return err
+				}
+				count++
+			}
+		}
+	}
+	fmt.Printf("%d nodetool histograms from %d files into %d meters\n", count, len(dumps), len(totals))
+	return nil
+}
+
+func readDumps(files []string, taken string, count float64) ([]dump, error) {
+	var at time.Time
+	if taken != "" {
+		if len(files) > 1 {
+			return nil, fmt.Errorf("-time only applies to a single dump")
+		}
+		t, err := time.Parse(time.RFC3339, taken)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid -time %q : %s", taken, err)
+		}
+		at = t
+	}
+	ret := make([]dump, 0, len(files))
+	for _, filename := range files {
+		fi, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		d := dump{filename: filename, taken: at}
+		if at.IsZero() {
+			st, err := fi.Stat()
+			if err != nil {
+				fi.Close()
+				return nil, err
+			}
+			d.taken = st.ModTime()
+		}
+		d.tables, err = frank.ParseNodetoolHistograms(fi, count)
+		fi.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+		ret = append(ret, d)
+	}
+	return ret, nil
+}
+
+func main() {
+	var (
+		save     = flag.String("save", "frank.sav", "save file to merge into, created if missing")
+		policy   = flag.String("policy", "max", "which sample wins on duplicate timestamps: replace, keep, or max (the one with more events)")
+		nodetool = flag.Bool("nodetool", false, "the files are nodetool cfhistograms/tablehistograms output rather than save files")
+		cluster  = flag.String("cluster", "", "cluster the nodetool output came from")
+		node     = flag.String("node", "", "node the nodetool output came from")
+		taken    = flag.String("time", "", "when a single nodetool dump was taken (RFC3339), defaults to the file's modification time")
+		count    = flag.Float64("count", 1000, "events to spread over the percentiles of Cassandra 2.1+ output")
+		period   = flag.Duration("period", time.Minute, "time covered by the first nodetool dump of each table")
+		dryRun   = flag.Bool("n", false, "report what would be imported without writing the save file")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(-1)
+	}
+	p, err := frank.ParseMergePolicy(*policy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(-1)
+	}
+
+	c := frank.DefaultUtilityConfig()
+	c.SaveFile = *save
+	u := frank.NewUtilityWithConfig(c)
+	if err := u.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load %s : %s\n", *save, err)
+		os.Exit(-1)
+	}
+	before := u.SizeMeters()
+
+	if *nodetool {
+		if *cluster == "" || *node == "" {
+			fmt.Fprintf(os.Stderr, "-nodetool needs -cluster and -node\n")
+			os.Exit(-1)
+		}
+		dumps, err := readDumps(flag.Args(), *taken, *count)
+		if err == nil {
+			err = importDumps(u, *cluster, *node, dumps, *period, p)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to import nodetool output : %s\n", err)
+			os.Exit(-1)
+		}
+	} else if err := mergeSaves(u, flag.Args(), p); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to merge save file : %s\n", err)
+		os.Exit(-1)
+	}
+
+	fmt.Printf("%d meters, %d new\n", u.SizeMeters(), u.SizeMeters()-before)
+	if *dryRun {
+		return
+	}
+	if err := u.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to save %s : %s\n", *save, err)
+		os.Exit(-1)
+	}
+	fmt.Printf("Saved to %s\n", *save)
+}
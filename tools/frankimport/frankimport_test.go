@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/cmceniry/frank"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const dumpText = `Space1/Test1 histograms
+Offset      SSTables     Write Latency      Read Latency          Row Size      Column Count
+1                  2                 0                 0                 0                 0
+24                 0                 4                 0                 0                 0
+`
+
+func TestImportDumps(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Unix(1410000000, 0)
+	files := make([]string, 3)
+	for x := range files {
+		files[x] = filepath.Join(dir, "cfhistograms."+string(rune('c'-x)))
+		if err := os.WriteFile(files[x], []byte(dumpText), 0644); err != nil {
+			t.Fatalf("Unable to write dump: %s", err)
+		}
+		taken := base.Add(time.Duration(2-x) * time.Minute)
+		os.Chtimes(files[x], taken, taken)
+	}
+	dumps, err := readDumps(files, "", 100)
+	if err != nil {
+		t.Fatalf("readDumps produced error: %s", err)
+	}
+	u := frank.NewUtility()
+	if err := importDumps(u, "TestCluster", "localhost", dumps, time.Minute, frank.MergeMax); err != nil {
+		t.Fatalf("importDumps produced error: %s", err)
+	}
+	m, err := u.GetMeter("TestCluster", "localhost", "Space1.Test1", "LifetimeWriteLatencyHistogramMicros")
+	if err != nil {
+		t.Fatalf("Write latency meter not imported: %s", err)
+	}
+	raw, _ := m.Raw()
+	if len(raw) != 4 || raw[0].TimestampMS != base.Add(-time.Minute).Unix()*1000 {
+		t.Fatalf("Invalid imported samples : %v", raw)
+	}
+	for x, s := range raw {
+		if s.Data[13] != float64(4*x) {
+			t.Errorf("Invalid cumulative count at %d : %f, should be %d", x, s.Data[13], 4*x)
+		}
+	}
+	// Row Size and Column Count are empty but still become meters.
+	if u.SizeMeters() != 5 {
+		t.Errorf("Invalid Meter Size : %d, should be 5", u.SizeMeters())
+	}
+
+	if _, err := readDumps(files, "2014-09-06T10:40:00Z", 100); err == nil {
+		t.Errorf("-time with several dumps should produce an error")
+	}
+}
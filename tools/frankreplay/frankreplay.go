@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/gob"
+	"flag"
+	"fmt"
+	"github.com/cmceniry/frank"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// span returns the first and last timestamps across the recordings.
+func span(files []string) (int64, int64, error) {
+	first, last := int64(-1), int64(-1)
+	for _, filename := range files {
+		fi, err := os.Open(filename)
+		if err != nil {
+			return 0, 0, err
+		}
+		p := frank.NewPlayback(fi)
+		for {
+			s, err := p.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				fi.Close()
+				return 0, 0, fmt.Errorf("%s: %s", filename, err)
+			}
+			if first < 0 || s.TimestampMS < first {
+				first = s.TimestampMS
+			}
+			if s.TimestampMS > last {
+				last = s.TimestampMS
+			}
+		}
+		fi.Close()
+	}
+	if first < 0 {
+		return 0, 0, fmt.Errorf("no samples in %v", files)
+	}
+	return first, last, nil
+}
+
+func main() {
+	var (
+		central = flag.String("central", "localhost:4271", "frankserv collector address (ip/name:port)")
+		speed   = flag.Float64("speed", 1, "playback speed relative to the original pace, 0 sends as fast as possible")
+		shift   = flag.String("shift", "none", "move timestamps so the recording starts now (start), ends now (end), or leave them (none)")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] recording...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 || *speed < 0 {
+		flag.Usage()
+		os.Exit(-1)
+	}
+
+	first, last, err := span(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read recording : %s\n", err)
+		os.Exit(-1)
+	}
+	now := time.Now().UnixNano() / 1e6
+	var offset int64
+	switch *shift {
+	case "none":
+	case "start":
+		offset = now - first
+	case "end":
+		offset = now - last
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -shift %q : must be start, end or none\n", *shift)
+		os.Exit(-1)
+	}
+
+	conn, err := net.Dial("tcp", *central)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to connect to %s : %s\n", *central, err)
+		os.Exit(-1)
+	}
+	defer conn.Close()
+	enc := gob.NewEncoder(conn)
+
+	start := time.Now()
+	sent := 0
+	for _, filename := range flag.Args() {
+		fi, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to open %s : %s\n", filename, err)
+			os.Exit(-1)
+		}
+		p := frank.NewPlayback(fi)
+		for {
+			s, err := p.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to read %s : %s\n", filename, err)
+				os.Exit(-1)
+			}
+			if *speed > 0 {
+				due := start.Add(time.Duration(float64(s.TimestampMS-first)/ *speed) * time.Millisecond)
+				time.Sleep(due.Sub(time.Now()))
+			}
+			s.TimestampMS += offset
+			if err := enc.Encode(s); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to send to %s : %s\n", *central, err)
+				os.Exit(-1)
+			}
+			sent++
+			if sent%1000 == 0 {
+				fmt.Printf("%d samples replayed\n", sent)
+			}
+		}
+		fi.Close()
+	}
+	fmt.Printf("%d samples replayed in %s\n", sent, time.Since(start))
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/cmceniry/frank"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AlertConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	Step     time.Duration `yaml:"step"`
+	Webhooks []string      `yaml:"webhooks"`
+	Rules    []AlertRule   `yaml:"rules"`
+}
+
+// An AlertRule watches the meters matching Meter, each on its own or, with
+// Sum, added together. Every evaluation the diffed histograms of the last
+// Window are summed, and the rule breaches when either the Percentile
+// latency or the share of events SlowerThan a latency is Above its
+// threshold. It fires once it has breached for For.
+type AlertRule struct {
+	Name       string        `yaml:"name"`
+	Meter      string        `yaml:"meter"`
+	Sum        bool          `yaml:"sum"`
+	Percentile float64       `yaml:"percentile"`
+	SlowerThan time.Duration `yaml:"slower_than"`
+	Above      string        `yaml:"above"`
+	For        time.Duration `yaml:"for"`
+	Window     time.Duration `yaml:"window"`
+}
+
+func DefaultAlertConfig() AlertConfig {
+	return AlertConfig{Interval: 30 * time.Second, Step: 5 * time.Second}
+}
+
+// threshold parses Above: a latency such as 50ms for percentile rules,
+// returned in microseconds like Labels, or a fraction such as 0.05 or 5%
+// for slower_than rules.
+func (r AlertRule) threshold() (float64, error) {
+	if r.Percentile > 0 {
+		d, err := time.ParseDuration(r.Above)
+		if err != nil {
+			return 0, fmt.Errorf("above must be a latency such as 50ms for a percentile rule")
+		}
+		return float64(d / time.Microsecond), nil
+	}
+	v := strings.TrimSpace(r.Above)
+	scale := 1.0
+	if strings.HasSuffix(v, "%") {
+		v, scale = strings.TrimSuffix(v, "%"), 100
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f/scale > 1 {
+		return 0, fmt.Errorf("above must be a fraction such as 0.05 or 5%% for a slower_than rule")
+	}
+	return f / scale, nil
+}
+
+func (r AlertRule) describe(value, threshold float64) string {
+	if r.Percentile > 0 {
+		return fmt.Sprintf("p%g %s > %s", r.Percentile, frank.FormatLatency(value), frank.FormatLatency(threshold))
+	}
+	return fmt.Sprintf("%.2f%% slower than %s > %.2f%%", value*100, r.SlowerThan, threshold*100)
+}
+
+func (c AlertConfig) Validate() error {
+	if len(c.Rules) == 0 {
+		return nil
+	}
+	if c.Interval <= 0 || c.Step <= 0 || c.Step%time.Second != 0 {
+		return fmt.Errorf("interval must be positive and step a positive number of seconds")
+	}
+	for _, w := range c.Webhooks {
+		if !strings.HasPrefix(w, "http://") && !strings.HasPrefix(w, "https://") {
+			return fmt.Errorf("webhook %q is not an http(s) URL", w)
+		}
+	}
+	names := make(map[string]bool)
+	for _, r := range c.Rules {
+		if r.Name == "" || names[r.Name] {
+			return fmt.Errorf("every rule needs a unique name, got %q", r.Name)
+		}
+		names[r.Name] = true
+		if _, err := path.Match(r.Meter, ""); err != nil || r.Meter == "" {
+			return fmt.Errorf("rule %s: invalid meter pattern %q", r.Name, r.Meter)
+		}
+		if (r.Percentile > 0) == (r.SlowerThan > 0) {
+			return fmt.Errorf("rule %s: set one of percentile or slower_than", r.Name)
+		}
+		if r.Percentile > 100 {
+			return fmt.Errorf("rule %s: percentile must be at most 100", r.Name)
+		}
+		if _, err := r.threshold(); err != nil {
+			return fmt.Errorf("rule %s: %s", r.Name, err)
+		}
+		if r.For < 0 || r.Window < 0 {
+			return fmt.Errorf("rule %s: for and window must not be negative", r.Name)
+		}
+	}
+	return nil
+}
+
+const (
+	alertPending  = "pending"
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// An alert is one rule applied to one meter, or to the sum of its meters.
+type alert struct {
+	Rule        string    `json:"rule"`
+	Meter       string    `json:"meter"`
+	State       string    `json:"state"`
+	Value       float64   `json:"value"`
+	Threshold   float64   `json:"threshold"`
+	Description string    `json:"description"`
+	Since       time.Time `json:"since"`
+	At          time.Time `json:"at"`
+}
+
+type alertEngine struct {
+	config AlertConfig
+	u      *frank.Utility
+	client *http.Client
+	mu     sync.Mutex
+	alerts map[string]*alert
+	queue  chan alert
+}
+
+// alertQueue is how many alerts may wait for delivery before new ones are
+// dropped.
+const alertQueue = 1000
+
+func newAlertEngine(c AlertConfig, u *frank.Utility) *alertEngine {
+	return &alertEngine{c, u, &http.Client{Timeout: 10 * time.Second}, sync.Mutex{}, make(map[string]*alert), make(chan alert, alertQueue)}
+}
+
+// window sums the events of meters over the window ending at the last step
+// before now, from the raw samples inside it.
+func (e *alertEngine) window(meters []*frank.Meter, window time.Duration, now time.Time) []float64 {
+	step := int64(e.config.Step / time.Millisecond)
+	end := now.UnixNano() / 1e6 / step * step
+	start := end - int64(window/time.Millisecond)
+	ret := make([]float64, len(frank.Labels))
+	for _, m := range meters {
+		raw, _ := m.Raw()
+		frank.WindowCounts(ret, raw, start, end)
+	}
+	return ret
+}
+
+// evaluate checks every rule at now and returns the alerts whose state
+// changed to firing or resolved.
+func (e *alertEngine) evaluate(now time.Time) []alert {
+	changed := make([]alert, 0)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	seen := make(map[string]bool)
+	for _, r := range e.config.Rules {
+		threshold, _ := r.threshold()
+		window := r.Window
+		if window == 0 {
+			window = time.Minute
+		}
+		meters, _ := e.u.MatchMeters(r.Meter)
+		groups := make(map[string][]*frank.Meter)
+		for _, m := range meters {
+			if r.Sum {
+				groups[r.Meter] = append(groups[r.Meter], m)
+			} else {
+				groups[m.Name] = []*frank.Meter{m}
+			}
+		}
+		for name, group := range groups {
+			data := e.window(group, window, now)
+			value := frank.FractionAbove(data, float64(r.SlowerThan/time.Microsecond))
+			if r.Percentile > 0 {
+				value = frank.Percentile(data, r.Percentile)
+			}
+			key := r.Name + "|" + name
+			seen[key] = true
+			if a, ok := e.step(key, r, name, frank.Count(data) > 0 && value > threshold, value, threshold, now); ok {
+				changed = append(changed, a)
+			}
+		}
+	}
+	// Meters that went away resolve their alerts.
+	for key, a := range e.alerts {
+		if !seen[key] {
+			if a, ok := e.step(key, AlertRule{Name: a.Rule}, a.Meter, false, 0, a.Threshold, now); ok {
+				changed = append(changed, a)
+			}
+		}
+	}
+	return changed
+}
+
+// step moves one alert through pending, firing and resolved, reporting
+// whether it should be notified.
+func (e *alertEngine) step(key string, r AlertRule, meter string, breached bool, value, threshold float64, now time.Time) (alert, bool) {
+	a, ok := e.alerts[key]
+	if !breached {
+		if !ok {
+			return alert{}, false
+		}
+		delete(e.alerts, key)
+		if a.State != alertFiring {
+			return alert{}, false
+		}
+		a.State, a.Value, a.At = alertResolved, value, now
+		return *a, true
+	}
+	if !ok {
+		a = &alert{Rule: r.Name, Meter: meter, State: alertPending, Threshold: threshold, Since: now}
+		e.alerts[key] = a
+	}
+	a.Value, a.At, a.Description = value, now, r.describe(value, threshold)
+	if a.State == alertPending && now.Sub(a.Since) >= r.For {
+		a.State = alertFiring
+		return *a, true
+	}
+	return alert{}, false
+}
+
+func (e *alertEngine) Alerts() []alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ret := make([]alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		ret = append(ret, *a)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Rule != ret[j].Rule {
+			return ret[i].Rule < ret[j].Rule
+		}
+		return ret[i].Meter < ret[j].Meter
+	})
+	return ret
+}
+
+// deliver posts each alert as JSON to every webhook, trying a few times.
+func (e *alertEngine) deliver(alerts []alert) {
+	for _, a := range alerts {
+		body, _ := json.Marshal(a)
+		for _, w := range e.config.Webhooks {
+			var err error
+			for attempt := 0; attempt < 3; attempt++ {
+				var resp *http.Response
+				resp, err = e.client.Post(w, "application/json", bytes.NewReader(body))
+				if err == nil {
+					resp.Body.Close()
+					if resp.StatusCode < 300 {
+						break
+					}
+					err = fmt.Errorf("%s", resp.Status)
+				}
+				if attempt < 2 {
+					time.Sleep(time.Duration(attempt+1) * time.Second)
+				}
+			}
+			if err != nil {
+				fmt.Printf("Unable to deliver %s alert %s for %s to %s : %s\n", a.State, a.Rule, a.Meter, w, err)
+			}
+		}
+	}
+}
+
+// notify queues alerts for delivery without waiting on the webhooks, so a
+// slow or dead one cannot hold up evaluation. Alerts that do not fit in the
+// queue are dropped.
+func (e *alertEngine) notify(alerts []alert) {
+	for _, a := range alerts {
+		select {
+		case e.queue <- a:
+		default:
+			fmt.Printf("Dropping %s alert %s for %s : delivery queue full\n", a.State, a.Rule, a.Meter)
+		}
+	}
+}
+
+func (e *alertEngine) sendQueued() {
+	for a := range e.queue {
+		e.deliver([]alert{a})
+	}
+}
+
+func (e *alertEngine) run() {
+	go e.sendQueued()
+	for now := range time.Tick(e.config.Interval) {
+		changed := e.evaluate(now)
+		for _, a := range changed {
+			fmt.Printf("Alert %s %s for %s : %s\n", a.Rule, a.State, a.Meter, a.Description)
+		}
+		e.notify(changed)
+	}
+}
+
+func (f *frankserver) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	if f.Alerts == nil {
+		writeJSON(w, []alert{})
+		return
+	}
+	writeJSON(w, f.Alerts.Alerts())
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/cmceniry/frank"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// addAnnotation stores the annotation in the JSON body, stamping it with the
+// current time when it has none, and answers with it and its new id.
+func (f *frankserver) addAnnotation(w http.ResponseWriter, r *http.Request) {
+	var a frank.Annotation
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		http.Error(w, "Unable to decode annotation: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if a.TimestampMS == 0 {
+		a.TimestampMS = time.Now().UnixNano() / 1e6
+	}
+	a, err := f.U.AddAnnotation(a)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, a)
+}
+
+func (f *frankserver) listAnnotations(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	starttime, endtime, err := rawRange(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, f.U.Annotations(q.Get("cluster"), q.Get("node"), q.Get("table"), starttime*1000, endtime*1000))
+}
+
+func (f *frankserver) deleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid annotation id", http.StatusBadRequest)
+		return
+	}
+	if err := f.U.DeleteAnnotation(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
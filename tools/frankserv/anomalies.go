@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"github.com/cmceniry/frank"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	ewmaWarmup = 100
+	day        = int64(24 * 60 * 60)
+)
+
+func floatParam(q url.Values, name string, def float64) (float64, error) {
+	v := q.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("Invalid %s %q", name, v)
+	}
+	return f, nil
+}
+
+// anomalyHandler scores the intervals of /align against a baseline: an
+// exponentially weighted average of the preceding intervals (baseline=ewma,
+// weight alpha), or the same time of day on the previous days
+// (baseline=daily). Intervals whose distance from the baseline exceeds
+// threshold are anomalous.
+func (f *frankserver) anomalyHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	m, err := f.U.GetMeter(vars["cluster"], vars["keyspace"], vars["cf"], vars["op"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	starttime, endtime, interval, err := alignRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	distance := q.Get("distance")
+	if distance == "" {
+		distance = "emd"
+	}
+	threshold, err := floatParam(q, "threshold", frank.DefaultAnomalyThresholds[distance])
+	var alpha, days, minCount float64
+	if err == nil {
+		alpha, err = floatParam(q, "alpha", 0.05)
+	}
+	if err == nil {
+		days, err = floatParam(q, "days", 7)
+	}
+	if err == nil {
+		minCount, err = floatParam(q, "min_count", 20)
+	}
+	if err == nil && (alpha <= 0 || alpha > 1 || days < 1 || days > 28) {
+		err = fmt.Errorf("alpha must be in (0, 1] and days between 1 and 28")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	raw, _ := m.Raw()
+	align := func(start, end int64) []frank.Sample {
+		return frank.Diff(frank.Align(raw, interval*1000, start*1000, end*1000))
+	}
+	var samples []frank.Sample
+	var baseline [][]float64
+	switch q.Get("baseline") {
+	case "", "ewma":
+		warm := align(starttime-ewmaWarmup*interval, endtime)
+		baseline = frank.EWMABaseline(warm, alpha)[ewmaWarmup:]
+		samples = warm[ewmaWarmup:]
+	case "daily":
+		samples = align(starttime, endtime)
+		series := make([][]frank.Sample, int(days))
+		for x := range series {
+			shift := int64(x+1) * day
+			series[x] = align(starttime-shift, endtime-shift)
+		}
+		baseline = frank.SumBaseline(series)
+	default:
+		http.Error(w, fmt.Sprintf("Unknown baseline %q", q.Get("baseline")), http.StatusBadRequest)
+		return
+	}
+	anomalies, err := frank.DetectAnomalies(samples, baseline, distance, threshold, minCount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, anomalies)
+}
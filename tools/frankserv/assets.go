@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"github.com/cmceniry/frank"
+	"io/fs"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// The web UI is built into the binary so that frankserv works from any
+// directory and without reaching a CDN.
+//
+//go:embed static
+var embedded embed.FS
+
+// staticFS serves static_dir when it is set, for working on the UI without
+// rebuilding, and the embedded assets otherwise.
+func (f *frankserver) staticFS() http.FileSystem {
+	if f.Config.StaticDir != "" {
+		return http.Dir(f.Config.StaticDir)
+	}
+	sub, err := fs.Sub(embedded, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.FS(sub)
+}
+
+// labelsJS defines the Labels the pages draw with from frank.Labels, so the
+// two cannot drift apart. The overflow bucket is "Higher".
+func labelsJS(w http.ResponseWriter, r *http.Request) {
+	var b bytes.Buffer
+	b.WriteString("var Labels = [\n")
+	for x, l := range frank.Labels {
+		v := strconv.FormatFloat(l, 'f', -1, 64)
+		if l == math.MaxFloat64 {
+			v = "Higher"
+		}
+		sep := ","
+		if x == len(frank.Labels)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&b, "\t%q%s\n", v, sep)
+	}
+	b.WriteString("]\n")
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Write(b.Bytes())
+}
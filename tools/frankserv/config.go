@@ -0,0 +1,217 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/cmceniry/frank"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	HTTPListen      string              `yaml:"http_listen"`
+	CollectorListen string              `yaml:"collector_listen"`
+	SaveInterval    time.Duration       `yaml:"save_interval"`
+	StaticDir       string              `yaml:"static_dir"`
+	PrintIncoming   bool                `yaml:"print_incoming"`
+	RecordFile      string              `yaml:"record_file"`
+	Peers           []string            `yaml:"peers"`
+	PeerTimeout     time.Duration       `yaml:"peer_timeout"`
+	Relays          []string            `yaml:"relays"`
+	RelayQueue      int                 `yaml:"relay_queue"`
+	Alerts          AlertConfig         `yaml:"alerts"`
+	Utility         frank.UtilityConfig `yaml:"utility"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		HTTPListen:      ":4270",
+		CollectorListen: ":4271",
+		SaveInterval:    30 * time.Second,
+		PrintIncoming:   false,
+		PeerTimeout:     5 * time.Second,
+		RelayQueue:      100000,
+		Alerts:          DefaultAlertConfig(),
+		Utility:         frank.DefaultUtilityConfig(),
+	}
+}
+
+func (c *Config) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Unable to read config file %s: %s", path, err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("Unable to parse config file %s: %s", path, err)
+	}
+	return nil
+}
+
+// Environment variables override the config file; flags override both.
+var envOverrides = []struct {
+	name string
+	set  func(c *Config, val string) error
+}{
+	{"FRANK_HTTP_LISTEN", func(c *Config, val string) error { c.HTTPListen = val; return nil }},
+	{"FRANK_COLLECTOR_LISTEN", func(c *Config, val string) error { c.CollectorListen = val; return nil }},
+	{"FRANK_SAVE_INTERVAL", func(c *Config, val string) (err error) { c.SaveInterval, err = time.ParseDuration(val); return }},
+	{"FRANK_STATIC_DIR", func(c *Config, val string) error { c.StaticDir = val; return nil }},
+	{"FRANK_RECORD_FILE", func(c *Config, val string) error { c.RecordFile = val; return nil }},
+	{"FRANK_PEERS", func(c *Config, val string) error { c.Peers = splitList(val); return nil }},
+	{"FRANK_PEER_TIMEOUT", func(c *Config, val string) (err error) { c.PeerTimeout, err = time.ParseDuration(val); return }},
+	{"FRANK_RELAYS", func(c *Config, val string) error { c.Relays = splitList(val); return nil }},
+	{"FRANK_RELAY_QUEUE", func(c *Config, val string) (err error) { c.RelayQueue, err = strconv.Atoi(val); return }},
+	{"FRANK_PRINT_INCOMING", func(c *Config, val string) (err error) { c.PrintIncoming, err = strconv.ParseBool(val); return }},
+	{"FRANK_BACKGROUND_SLEEP", func(c *Config, val string) (err error) { c.Utility.BackgroundSleep, err = strconv.Atoi(val); return }},
+	{"FRANK_BACKGROUND_PAUSE", func(c *Config, val string) (err error) { c.Utility.BackgroundPause, err = strconv.ParseBool(val); return }},
+	{"FRANK_SAMPLE_THRESHOLD", func(c *Config, val string) (err error) { c.Utility.SampleThreshold, err = strconv.Atoi(val); return }},
+	{"FRANK_SAVE_FILE", func(c *Config, val string) error { c.Utility.SaveFile = val; return nil }},
+}
+
+func splitList(val string) []string {
+	ret := make([]string, 0)
+	for _, v := range strings.Split(val, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func (c *Config) ApplyEnv() error {
+	for _, e := range envOverrides {
+		val, ok := os.LookupEnv(e.name)
+		if !ok {
+			continue
+		}
+		if err := e.set(c, val); err != nil {
+			return fmt.Errorf("Invalid value for %s: %s", e.name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	if c.HTTPListen == "" {
+		return fmt.Errorf("http_listen must be set")
+	}
+	if c.CollectorListen == "" {
+		return fmt.Errorf("collector_listen must be set")
+	}
+	if c.HTTPListen == c.CollectorListen {
+		return fmt.Errorf("http_listen and collector_listen must differ, both are %s", c.HTTPListen)
+	}
+	if c.SaveInterval <= 0 {
+		return fmt.Errorf("save_interval must be positive, got %s", c.SaveInterval)
+	}
+	if c.StaticDir != "" {
+		if fi, err := os.Stat(c.StaticDir); err != nil {
+			return fmt.Errorf("static_dir %s: %s", c.StaticDir, err)
+		} else if !fi.IsDir() {
+			return fmt.Errorf("static_dir %s is not a directory", c.StaticDir)
+		}
+	}
+	for _, p := range c.Peers {
+		if u, err := url.Parse(p); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("peers: %q is not an http(s) URL", p)
+		}
+	}
+	if len(c.Peers) > 0 && c.PeerTimeout <= 0 {
+		return fmt.Errorf("peer_timeout must be positive, got %s", c.PeerTimeout)
+	}
+	for _, r := range c.Relays {
+		if _, _, err := net.SplitHostPort(r); err != nil {
+			return fmt.Errorf("relays: %q is not a host:port collector address", r)
+		}
+		if r == c.CollectorListen {
+			return fmt.Errorf("relays: %s is this server's own collector_listen", r)
+		}
+	}
+	if len(c.Relays) > 0 && c.RelayQueue <= 0 {
+		return fmt.Errorf("relay_queue must be positive, got %d", c.RelayQueue)
+	}
+	if err := c.Alerts.Validate(); err != nil {
+		return fmt.Errorf("alerts: %s", err)
+	}
+	if err := c.Utility.Validate(); err != nil {
+		return fmt.Errorf("utility: %s", err)
+	}
+	return nil
+}
+
+func (c *Config) Dump() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// loadConfig builds the effective configuration from defaults, the config
+// file, the environment and finally any flags set on the command line.
+func loadConfig(fs *flag.FlagSet, args []string) (Config, error) {
+	c := DefaultConfig()
+	var (
+		configFile      = fs.String("config", os.Getenv("FRANK_CONFIG"), "path to YAML config file")
+		httpListen      = fs.String("http", c.HTTPListen, "address for the HTTP interface")
+		collectorListen = fs.String("collector", c.CollectorListen, "address for incoming collector streams")
+		saveInterval    = fs.Duration("save-interval", c.SaveInterval, "how often to save data to disk")
+		staticDir       = fs.String("static", c.StaticDir, "directory of static web assets, instead of the built in ones")
+		printIncoming   = fs.Bool("print", c.PrintIncoming, "print incoming samples")
+		recordFile      = fs.String("record", c.RecordFile, "file to record incoming samples to")
+		peers           = fs.String("peers", "", "comma separated base URLs of peer frankservs to federate")
+		peerTimeout     = fs.Duration("peer-timeout", c.PeerTimeout, "how long to wait for a peer frankserv")
+		relays          = fs.String("relays", "", "comma separated collector addresses of standby frankservs to relay samples to")
+		relayQueue      = fs.Int("relay-queue", c.RelayQueue, "samples to queue per relay while it is unreachable")
+		backgroundSleep = fs.Int("background-sleep", c.Utility.BackgroundSleep, "seconds between background cleanups")
+		backgroundPause = fs.Bool("background-pause", c.Utility.BackgroundPause, "pause background cleanups")
+		sampleThreshold = fs.Int("sample-threshold", c.Utility.SampleThreshold, "samples to keep per meter")
+		saveFile        = fs.String("save-file", c.Utility.SaveFile, "file to save data to")
+	)
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if *configFile != "" {
+		if err := c.LoadFile(*configFile); err != nil {
+			return c, err
+		}
+	}
+	if err := c.ApplyEnv(); err != nil {
+		return c, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "http":
+			c.HTTPListen = *httpListen
+		case "collector":
+			c.CollectorListen = *collectorListen
+		case "save-interval":
+			c.SaveInterval = *saveInterval
+		case "static":
+			c.StaticDir = *staticDir
+		case "print":
+			c.PrintIncoming = *printIncoming
+		case "record":
+			c.RecordFile = *recordFile
+		case "peers":
+			c.Peers = splitList(*peers)
+		case "peer-timeout":
+			c.PeerTimeout = *peerTimeout
+		case "relays":
+			c.Relays = splitList(*relays)
+		case "relay-queue":
+			c.RelayQueue = *relayQueue
+		case "background-sleep":
+			c.Utility.BackgroundSleep = *backgroundSleep
+		case "background-pause":
+			c.Utility.BackgroundPause = *backgroundPause
+		case "sample-threshold":
+			c.Utility.SampleThreshold = *sampleThreshold
+		case "save-file":
+			c.Utility.SaveFile = *saveFile
+		}
+	})
+	return c, nil
+}
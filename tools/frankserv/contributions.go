@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/cmceniry/frank"
+	"net/http"
+	"strings"
+)
+
+var contributionKeys = map[string]int{"cluster": 0, "node": 1, "cf": 2, "op": 3}
+
+// contributionsHandler breaks the events of the meters matching the meter
+// patterns between start and end, in the buckets holding latencies min to
+// max, down by node (or by=cf, cluster, op or meter), for drilling into a
+// cell of an /aggregate heatmap. The range is aligned as for /align.
+func (f *frankserver) contributionsHandler(w http.ResponseWriter, r *http.Request) {
+	starttime, endtime, interval, err := alignRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	opts, _, err := bucketOptions(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	by := q.Get("by")
+	if by == "" {
+		by = "node"
+	}
+	if _, ok := contributionKeys[by]; !ok && by != "meter" {
+		http.Error(w, "by must be cluster, node, cf, op or meter", http.StatusBadRequest)
+		return
+	}
+	if len(q["meter"]) == 0 {
+		http.Error(w, "contributions needs one or more meter patterns", http.StatusBadRequest)
+		return
+	}
+	meters, err := f.U.MatchMeters(q["meter"]...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	keys := make([]string, len(meters))
+	series := make([][]frank.Sample, len(meters))
+	for x, m := range meters {
+		keys[x] = m.Name
+		if by != "meter" {
+			keys[x] = strings.Split(m.Name, ":")[contributionKeys[by]]
+		}
+		raw, _ := m.Raw()
+		series[x] = frank.Diff(frank.Align(raw, interval*1000, starttime*1000, endtime*1000))
+	}
+	writeJSON(w, frank.Contributions(keys, series, opts.Min, opts.Max))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/cmceniry/frank"
+	"net/http"
+)
+
+// aggregateHandler aligns and diffs every meter matching the meter patterns
+// as /align does, and combines them with aggregation (sum by default) for
+// dashboard panels. normalize and stats work as for /align.
+func (f *frankserver) aggregateHandler(w http.ResponseWriter, r *http.Request) {
+	starttime, endtime, interval, err := alignRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	how := q.Get("aggregation")
+	if how == "" {
+		how = "sum"
+	}
+	if len(q["meter"]) == 0 {
+		http.Error(w, "aggregate needs one or more meter patterns", http.StatusBadRequest)
+		return
+	}
+	meters, err := f.U.MatchMeters(q["meter"]...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	series := make([][]frank.Sample, len(meters))
+	for x, m := range meters {
+		raw, _ := m.Raw()
+		series[x] = frank.Diff(frank.Align(raw, interval*1000, starttime*1000, endtime*1000))
+	}
+	samples, err := frank.Aggregate(series, how)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeAligned(w, r, samples)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cmceniry/frank"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A federation merges the API of peer frankservs into this one. Requests to
+// peers carry local=1 so that peers which federate each other only answer
+// from their own data.
+type federation struct {
+	peers  []string
+	client *http.Client
+	mu     sync.Mutex
+	status map[string]peerStatus
+}
+
+type peerStatus struct {
+	Peer    string    `json:"peer"`
+	OK      bool      `json:"ok"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// peerErrorHeader lists the peers that could not be reached, so clients can
+// tell a partial answer from a complete one.
+const peerErrorHeader = "X-Frank-Peer-Errors"
+
+func newFederation(peers []string, timeout time.Duration) *federation {
+	fd := &federation{
+		peers:  make([]string, len(peers)),
+		client: &http.Client{Timeout: timeout},
+		status: make(map[string]peerStatus),
+	}
+	for x, p := range peers {
+		fd.peers[x] = strings.TrimRight(p, "/")
+	}
+	return fd
+}
+
+func (fd *federation) record(peer string, err error) {
+	st := peerStatus{Peer: peer, OK: err == nil, Checked: time.Now()}
+	if err != nil {
+		st.Error = err.Error()
+	}
+	fd.mu.Lock()
+	fd.status[peer] = st
+	fd.mu.Unlock()
+}
+
+func (fd *federation) Status() []peerStatus {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	ret := make([]peerStatus, len(fd.peers))
+	for x, p := range fd.peers {
+		st, ok := fd.status[p]
+		if !ok {
+			st = peerStatus{Peer: p, Error: "not contacted yet"}
+		}
+		ret[x] = st
+	}
+	return ret
+}
+
+func (fd *federation) get(peer, path string, query url.Values) ([]byte, error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("local", "1")
+	resp, err := fd.client.Get(peer + path + "?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// gather fetches path from every peer at once and decodes each JSON answer
+// with decode, one at a time. A peer answering 404 simply has nothing to
+// add; the peers that failed are returned.
+func (fd *federation) gather(path string, query url.Values, decode func(data []byte) error) []string {
+	bodies := make([][]byte, len(fd.peers))
+	errs := make([]error, len(fd.peers))
+	var wg sync.WaitGroup
+	for x, p := range fd.peers {
+		wg.Add(1)
+		go func(x int, p string) {
+			defer wg.Done()
+			bodies[x], errs[x] = fd.get(p, path, query)
+		}(x, p)
+	}
+	wg.Wait()
+	failed := make([]string, 0)
+	for x, p := range fd.peers {
+		if errs[x] == nil && bodies[x] != nil {
+			if err := decode(bodies[x]); err != nil {
+				errs[x] = fmt.Errorf("Unable to decode %s: %s", path, err)
+			}
+		}
+		fd.record(p, errs[x])
+		if errs[x] != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", p, errs[x]))
+		}
+	}
+	return failed
+}
+
+// federated reports whether a request should include the peers.
+func (f *frankserver) federated(r *http.Request) bool {
+	return f.Fed != nil && r.URL.Query().Get("local") == ""
+}
+
+func setPeerErrors(w http.ResponseWriter, failed []string) {
+	if len(failed) > 0 {
+		w.Header().Set(peerErrorHeader, strings.Join(failed, "; "))
+	}
+}
+
+// mergeNames adds the names in a JSON list to set.
+func mergeNames(set map[string]bool) func([]byte) error {
+	return func(data []byte) error {
+		var names []string
+		if err := json.Unmarshal(data, &names); err != nil {
+			return err
+		}
+		for _, n := range names {
+			set[n] = true
+		}
+		return nil
+	}
+}
+
+func sortedNames(set map[string]bool) []string {
+	ret := make([]string, 0, len(set))
+	for n := range set {
+		ret = append(ret, n)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// mergeRaw decodes the /raw answer of a peer and adds its samples to dst,
+// keeping dst's at timestamps both have. A meter held by several servers,
+// after a collector failed over or on a relay standby, is merged this way
+// before aligning: summing each server's aligned diffs would count the
+// events of the gaps, which Align interpolates over, more than once.
+func mergeRaw(dst []frank.Sample, data []byte) ([]frank.Sample, error) {
+	var peer []MyResp
+	if err := json.Unmarshal(data, &peer); err != nil {
+		return dst, err
+	}
+	seen := make(map[int64]bool, len(dst))
+	for _, s := range dst {
+		seen[s.TimestampMS] = true
+	}
+	for _, p := range peer {
+		ts, err := strconv.ParseInt(p.TS, 10, 64)
+		if err != nil {
+			return dst, fmt.Errorf("Invalid timestamp %q", p.TS)
+		}
+		if !seen[ts] {
+			seen[ts] = true
+			dst = append(dst, frank.Sample{TimestampMS: ts, Data: p.Data})
+		}
+	}
+	sort.Slice(dst, func(i, j int) bool { return dst[i].TimestampMS < dst[j].TimestampMS })
+	return dst, nil
+}
+
+func (f *frankserver) federationHandler(w http.ResponseWriter, r *http.Request) {
+	if f.Fed == nil {
+		writeJSON(w, []peerStatus{})
+		return
+	}
+	writeJSON(w, f.Fed.Status())
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/cmceniry/frank"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// handleNamed serves a store of named values, such as SLOs or dashboards,
+// under prefix: GET lists them all, and GET, PUT and DELETE on
+// prefix/{name} get, store and delete one. PUT takes the value from the
+// JSON body with its name from the path, replacing any earlier version.
+func handleNamed[T frank.Named[T]](r *mux.Router, prefix string, s *frank.Store[T]) {
+	r.HandleFunc(prefix, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.All())
+	}).Methods("GET")
+	r.HandleFunc(prefix+"/{name}", func(w http.ResponseWriter, r *http.Request) {
+		v, ok := s.Get(mux.Vars(r)["name"])
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, v)
+	}).Methods("GET")
+	r.HandleFunc(prefix+"/{name}", func(w http.ResponseWriter, r *http.Request) {
+		var v T
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			http.Error(w, "Unable to decode "+s.Kind()+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		v, created, err := s.Put(mux.Vars(r)["name"], v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		}
+		writeJSON(w, v)
+	}).Methods("PUT")
+	r.HandleFunc(prefix+"/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Delete(mux.Vars(r)["name"]); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/cmceniry/frank"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A relay forwards every stored sample to the collector port of a standby
+// frankserv. Samples wait in a bounded queue while the standby is
+// unreachable; once it is full new samples are dropped and counted.
+type relay struct {
+	dst   string
+	queue chan frank.NamedSample
+	mu    sync.Mutex
+	st    relayStatus
+}
+
+type relayStatus struct {
+	Destination string `json:"destination"`
+	Connected   bool   `json:"connected"`
+	Queued      int    `json:"queued"`
+	Sent        int64  `json:"sent"`
+	Dropped     int64  `json:"dropped"`
+	Error       string `json:"error,omitempty"`
+}
+
+var (
+	relayDialTimeout = 5 * time.Second
+	relayMinDelay    = time.Second
+	relayMaxDelay    = time.Minute
+)
+
+func newRelay(dst string, size int) *relay {
+	return &relay{dst: dst, queue: make(chan frank.NamedSample, size), st: relayStatus{Destination: dst}}
+}
+
+// Offer queues a sample without blocking the store.
+func (r *relay) Offer(s frank.NamedSample) {
+	select {
+	case r.queue <- s:
+	default:
+		r.mu.Lock()
+		r.st.Dropped++
+		r.mu.Unlock()
+	}
+}
+
+func (r *relay) Status() relayStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.st
+	st.Queued = len(r.queue)
+	return st
+}
+
+func (r *relay) setConnected(err error) {
+	r.mu.Lock()
+	r.st.Connected = err == nil
+	r.st.Error = ""
+	if err != nil {
+		r.st.Error = err.Error()
+	}
+	r.mu.Unlock()
+}
+
+// run sends queued samples for ever, reconnecting with a growing delay. A
+// sample whose send failed is sent again on the next connection.
+func (r *relay) run() {
+	var pending *frank.NamedSample
+	delay := relayMinDelay
+	for {
+		conn, err := net.DialTimeout("tcp", r.dst, relayDialTimeout)
+		if err == nil {
+			r.setConnected(nil)
+			delay = relayMinDelay
+			pending, err = r.send(conn, pending)
+			conn.Close()
+		}
+		r.setConnected(err)
+		fmt.Printf("Error relaying to %s, retrying in %s : %s\n", r.dst, delay, err)
+		time.Sleep(delay)
+		if delay < relayMaxDelay {
+			delay *= 2
+		}
+	}
+}
+
+func (r *relay) send(conn net.Conn, pending *frank.NamedSample) (*frank.NamedSample, error) {
+	enc := gob.NewEncoder(conn)
+	for {
+		if pending == nil {
+			s := <-r.queue
+			pending = &s
+		}
+		if err := enc.Encode(*pending); err != nil {
+			return pending, err
+		}
+		pending = nil
+		r.mu.Lock()
+		r.st.Sent++
+		r.mu.Unlock()
+	}
+}
+
+func (f *frankserver) relayHandler(w http.ResponseWriter, r *http.Request) {
+	ret := make([]relayStatus, len(f.Relays))
+	for x, rl := range f.Relays {
+		ret[x] = rl.Status()
+	}
+	writeJSON(w, ret)
+}
@@ -4,11 +4,15 @@ import (
 	"encoding/json"
 	"encoding/gob"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/cmceniry/frank"
 	"log"
+	"math"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 	"github.com/gorilla/mux"
@@ -22,10 +26,15 @@ type MyResp struct {
 }
 
 type frankserver struct {
+	Config Config
 	U *frank.Utility
 	Storer chan frank.NamedSample
 	Printer chan frank.NamedSample
 	Print bool
+	Recorder *frank.Recorder
+	Fed *federation
+	Relays []*relay
+	Alerts *alertEngine
 }
 
 var (
@@ -35,37 +44,40 @@ var (
 )
 
 func (f *frankserver) CollectorListen() {
+	ln, err := net.Listen("tcp", f.Config.CollectorListen)
+	if err != nil {
+		fmt.Printf("Error starting listener: %s\n", err)
+		return
+	}
+	f.serveCollectors(ln)
+}
+
+func (f *frankserver) serveCollectors(ln net.Listener) {
+	defer ln.Close()
 	for {
-		ln, err := net.Listen("tcp", ":4271")
+		conn, err := ln.Accept()
 		if err != nil {
-			fmt.Printf("Error starting listener: %s\n", err)
-			time.Sleep(5 * time.Second)
-			break
-		}
-		defer ln.Close()
-		for {
-			conn, err := ln.Accept()
-			if err != nil {
-				fmt.Printf("Error accepting a connection: %s\n", err)
-				continue
+			if errors.Is(err, net.ErrClosed) {
+				return
 			}
-			go func(c net.Conn) {
-				defer c.Close()
-				var (
-					res frank.NamedSample
-					err error
-				)
-				dec := gob.NewDecoder(c)
-				for {
-					err = dec.Decode(&res)
-					if err != nil {
-						fmt.Printf("Error receiving %s\n", err)
-						break
-					}
-					f.Storer <- res
-				}
-			}(conn)
+			fmt.Printf("Error accepting a connection: %s\n", err)
+			continue
 		}
+		go func(c net.Conn) {
+			defer c.Close()
+			dec := gob.NewDecoder(c)
+			for {
+				// Decode into a fresh sample each time, gob reuses the
+				// Data slice of the target and it is stored as is.
+				var res frank.NamedSample
+				err := dec.Decode(&res)
+				if err != nil {
+					fmt.Printf("Error receiving %s\n", err)
+					break
+				}
+				f.Storer <- res
+			}
+		}(conn)
 	}
 }
 
@@ -75,19 +87,44 @@ func (f *frankserver) Store() {
 		if true {
 			f.Printer <- chunk
 		}
+		if f.Recorder != nil {
+			if err := f.Recorder.Record(chunk); err != nil {
+				fmt.Printf("Error recording, recording stopped: %s\n", err)
+				f.Recorder = nil
+			}
+		}
 		names := strings.Split(chunk.Name, ":")
 		if len(names) != 4 {
 			continue
 		}
+		if chunk.Node != nil {
+			f.U.SetNodeInfo(names[0], names[1], *chunk.Node)
+		}
 		if err := f.U.AddSample(names[0], names[1], names[2], names[3], chunk.Sample); err != nil {
 			if _, err := f.U.NewMeter(names[0], names[1], names[2], names[3]); err != nil {
 				continue
 			}
 			f.U.AddSample(names[0], names[1], names[2], names[3], chunk.Sample)
 		}
+		for _, r := range f.Relays {
+			r.Offer(chunk)
+		}
 	}
 }
 
+// openRecording starts a new recording, moving any earlier recording at the
+// same path aside rather than appending to or overwriting it.
+func openRecording(filename string) (*os.File, error) {
+	if fi, err := os.Stat(filename); err == nil {
+		old := filename + "." + fi.ModTime().Format("20060102T150405")
+		if err := os.Rename(filename, old); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Moved previous recording to %s\n", old)
+	}
+	return os.Create(filename)
+}
+
 func (f *frankserver) PrintIncoming() {
 	for {
 		chunk := <- f.Printer
@@ -122,79 +159,352 @@ func (f *frankserver) rawHandler(w http.ResponseWriter, r *http.Request) {
 
 func (f *frankserver) alignHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	m, err := f.U.GetMeter(vars["cluster"], vars["keyspace"], vars["cf"], vars["op"])
+	starttime, endtime, interval, err := alignRange(r)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var raw []frank.Sample
+	found := false
+	if m, err := f.U.GetMeter(vars["cluster"], vars["keyspace"], vars["cf"], vars["op"]); err == nil {
+		raw, _ = m.Raw()
+		found = true
+	}
+	if f.federated(r) {
+		// Peers' raw samples are merged with ours, so that the range is
+		// aligned once over all of them.
+		path := "/raw"
+		for _, k := range []string{"cluster", "keyspace", "cf", "op"} {
+			path += "/" + url.PathEscape(vars[k])
+		}
+		failed := f.Fed.gather(path, nil, func(data []byte) error {
+			var err error
+			raw, err = mergeRaw(raw, data)
+			found = true
+			return err
+		})
+		setPeerErrors(w, failed)
+	}
+	if !found {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	starttime := (time.Now().Unix()/5 - 100)*5
-	endtime   := (time.Now().Unix()/5)*5
-	dstr, _ := m.Raw()
-	dstr = frank.Align(dstr, 5000, starttime * 1000, endtime * 1000)
+	dstr := frank.Align(raw, interval * 1000, starttime * 1000, endtime * 1000)
 	dstr = frank.Diff(dstr)
-	djson, err := json.Marshal(dstr)
+	writeAligned(w, r, dstr)
+}
+
+// alignedRows is the answer to /align when its buckets are coarsened or
+// cropped, or stats are asked for: the samples, one value per row, the
+// upper bound of each row in microseconds and, with stats=1, statistics of
+// the values for picking a color scale.
+type alignedRows struct {
+	Normalize string            `json:"normalize"`
+	Labels    []float64         `json:"labels"`
+	Samples   []frank.Sample    `json:"samples"`
+	Stats     *frank.ValueStats `json:"stats,omitempty"`
+}
+
+// bucketOptions reads the rows or bounds (latencies such as 1ms,10ms) to
+// merge buckets into, the min and max latencies to crop to, and trim.
+func bucketOptions(q url.Values) (frank.BucketOptions, bool, error) {
+	var o frank.BucketOptions
+	var err error
+	if v := q.Get("rows"); v != "" {
+		if o.Rows, err = strconv.Atoi(v); err != nil || o.Rows <= 0 {
+			return o, false, fmt.Errorf("Invalid rows %q", v)
+		}
+	}
+	if v := q.Get("bounds"); v != "" {
+		if o.Bounds, err = frank.ParseLatencies(v); err != nil {
+			return o, false, err
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *float64
+	}{{"min", &o.Min}, {"max", &o.Max}} {
+		if v := q.Get(p.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return o, false, fmt.Errorf("Invalid %s %q, expected a latency such as 10ms", p.name, v)
+			}
+			*p.dst = float64(d / time.Microsecond)
+		}
+	}
+	o.Trim = q.Get("trim") != ""
+	set := o.Rows > 0 || len(o.Bounds) > 0 || o.Min > 0 || o.Max > 0 || o.Trim
+	return o, set, nil
+}
+
+// writeAligned coarsens and crops aligned samples as asked, then scales
+// them by the normalize query parameter, count by default. Plain samples
+// are written unless the rows changed or stats were asked for.
+func writeAligned(w http.ResponseWriter, r *http.Request, samples []frank.Sample) {
+	q := r.URL.Query()
+	opts, coarsen, err := bucketOptions(q)
 	if err != nil {
-		log.Printf("Unable to marshal: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(djson)
+	labels := frank.Labels
+	if coarsen {
+		if samples, labels, err = frank.Coarsen(samples, opts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	mode := q.Get("normalize")
+	samples, err = frank.Normalize(samples, mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !coarsen && q.Get("stats") == "" {
+		writeJSON(w, samples)
+		return
+	}
+	if mode == "" {
+		mode = "count"
+	}
+	resp := alignedRows{Normalize: mode, Labels: labels, Samples: samples}
+	if q.Get("stats") != "" {
+		st := frank.Stats(samples)
+		resp.Stats = &st
+	}
+	writeJSON(w, resp)
 }
 
-func (f *frankserver) listClusters(w http.ResponseWriter, r *http.Request) {
-	c := f.U.ClusterNames()
-	cjson, err := json.Marshal(c)
+const maxAlignBins = 20000
+
+// alignRange reads the start and end (unix seconds) and interval (seconds)
+// query parameters, defaulting to the last 100 intervals of 5 seconds.
+func alignRange(r *http.Request) (int64, int64, int64, error) {
+	q := r.URL.Query()
+	interval := int64(5)
+	if v := q.Get("interval"); v != "" {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || i <= 0 {
+			return 0, 0, 0, fmt.Errorf("Invalid interval %q", v)
+		}
+		interval = i
+	}
+	endtime := (time.Now().Unix()/interval)*interval
+	if v := q.Get("end"); v != "" {
+		e, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("Invalid end %q", v)
+		}
+		endtime = (e/interval)*interval
+	}
+	starttime := endtime - 100*interval
+	if v := q.Get("start"); v != "" {
+		s, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("Invalid start %q", v)
+		}
+		starttime = (s/interval)*interval
+	}
+	if starttime >= endtime {
+		return 0, 0, 0, fmt.Errorf("start must be before end")
+	}
+	if (endtime-starttime)/interval > maxAlignBins {
+		return 0, 0, 0, fmt.Errorf("Too many intervals, at most %d", maxAlignBins)
+	}
+	return starttime, endtime, interval, nil
+}
+
+// exportHandler streams the meters matching the meter patterns (all by
+// default) in the requested format. With an interval the samples are aligned
+// and diffed as for /align, otherwise the raw cumulative samples between
+// start and end are written.
+func (f *frankserver) exportHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = frank.ExportCSV
+	}
+	patterns := q["meter"]
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+	meters, err := f.U.MatchMeters(patterns...)
 	if err != nil {
-		log.Printf("Unable to marshal: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(cjson)
+	aligned := q.Get("interval") != ""
+	var starttime, endtime, interval int64
+	if aligned {
+		starttime, endtime, interval, err = alignRange(r)
+	} else {
+		starttime, endtime, err = rawRange(q)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctype, ext := frank.ExportContentType(format)
+	e, err := frank.NewExporter(w, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=frank-export.%s", ext))
+	for _, m := range meters {
+		samples, _ := m.Raw()
+		if aligned {
+			if len(samples) == 0 {
+				continue
+			}
+			samples = frank.Diff(frank.Align(samples, interval*1000, starttime*1000, endtime*1000))
+		}
+		for _, s := range samples {
+			if !aligned && (s.TimestampMS < starttime*1000 || s.TimestampMS > endtime*1000) {
+				continue
+			}
+			if err := e.Write(m.Name, s); err != nil {
+				log.Printf("Unable to export %s: %s", m.Name, err)
+				return
+			}
+		}
+	}
+	if err := e.Close(); err != nil {
+		log.Printf("Unable to export: %s", err)
+	}
 }
 
-func (f *frankserver) showCluster(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	ci := make(map[string][]string)
-	ci["name"] = []string{vars["cluster"]}
-	ci["nodes"] = f.U.NodeNames(vars["cluster"])
-	ci["columnfamilies"] = f.U.CFNames(vars["cluster"])
-	cijson, err := json.Marshal(ci)
+// rawRange reads the optional start and end (unix seconds) query parameters,
+// defaulting to everything.
+func rawRange(q url.Values) (int64, int64, error) {
+	starttime, endtime := int64(0), int64(math.MaxInt64/1000)
+	if v := q.Get("start"); v != "" {
+		s, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Invalid start %q", v)
+		}
+		starttime = s
+	}
+	if v := q.Get("end"); v != "" {
+		e, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Invalid end %q", v)
+		}
+		endtime = e
+	}
+	if starttime > endtime {
+		return 0, 0, fmt.Errorf("start must be before end")
+	}
+	return starttime, endtime, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
 	if err != nil {
 		log.Printf("Unable to marshal: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(cijson)
-	return
+	w.Write(data)
 }
 
-func main() {
+func (f *frankserver) listMeters(w http.ResponseWriter, r *http.Request) {
+	cluster := r.URL.Query().Get("cluster")
+	set := make(map[string]bool)
+	for _, name := range f.U.MeterNames() {
+		if cluster == "" || strings.HasPrefix(name, cluster+":") {
+			set[name] = true
+		}
+	}
+	if f.federated(r) {
+		q := url.Values{}
+		if cluster != "" {
+			q.Set("cluster", cluster)
+		}
+		setPeerErrors(w, f.Fed.gather("/meters", q, mergeNames(set)))
+	}
+	writeJSON(w, sortedNames(set))
+}
 
-  f := frankserver{
-		frank.NewUtility(),
-		make(chan frank.NamedSample),
-		make(chan frank.NamedSample),
-		false,
+func (f *frankserver) deleteMeter(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := f.U.DeleteMeter(vars["cluster"], vars["keyspace"], vars["cf"], vars["op"]); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
 	}
-	f.U.Load()
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	go f.CollectorListen()
-	go f.Store()
-	go f.PrintIncoming()
-	go func(){
-		for _ = range time.Tick(30 * time.Second) {
-			fmt.Printf("Save\n")
-			f.U.Save()
-			fmt.Printf("Done\n")
-		}
-	}()
+func (f *frankserver) saveHandler(w http.ResponseWriter, r *http.Request) {
+	if err := f.U.Save(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "Saved %d meters to %s\n", f.U.SizeMeters(), f.U.Config.SaveFile)
+}
+
+func (f *frankserver) listClusters(w http.ResponseWriter, r *http.Request) {
+	set := make(map[string]bool)
+	for _, name := range f.U.ClusterNames() {
+		set[name] = true
+	}
+	if f.federated(r) {
+		setPeerErrors(w, f.Fed.gather("/clusters", nil, mergeNames(set)))
+	}
+	writeJSON(w, sortedNames(set))
+}
+
+// clusterInfo is the answer to /clusters/{cluster}. Hosts has the address,
+// datacenter and rack of the nodes named by host_id.
+type clusterInfo struct {
+	Name           []string                  `json:"name"`
+	Nodes          []string                  `json:"nodes"`
+	ColumnFamilies []string                  `json:"columnfamilies"`
+	Hosts          map[string]frank.NodeInfo `json:"hosts"`
+}
 
+func (f *frankserver) showCluster(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	nodes, cfs := make(map[string]bool), make(map[string]bool)
+	for _, n := range f.U.NodeNames(vars["cluster"]) {
+		nodes[n] = true
+	}
+	for _, cf := range f.U.CFNames(vars["cluster"]) {
+		cfs[cf] = true
+	}
+	hosts := f.U.NodeInfos(vars["cluster"])
+	if f.federated(r) {
+		failed := f.Fed.gather("/clusters/"+url.PathEscape(vars["cluster"]), nil, func(data []byte) error {
+			var peer clusterInfo
+			if err := json.Unmarshal(data, &peer); err != nil {
+				return err
+			}
+			for _, n := range peer.Nodes {
+				nodes[n] = true
+			}
+			for _, cf := range peer.ColumnFamilies {
+				cfs[cf] = true
+			}
+			for n, info := range peer.Hosts {
+				if _, ok := hosts[n]; !ok {
+					hosts[n] = info
+				}
+			}
+			return nil
+		})
+		setPeerErrors(w, failed)
+	}
+	writeJSON(w, clusterInfo{[]string{vars["cluster"]}, sortedNames(nodes), sortedNames(cfs), hosts})
+}
+
+func (f *frankserver) router() *mux.Router {
 	r := mux.NewRouter()
 	r.HandleFunc("/raw/{cluster}/{keyspace}/{cf}/{op}", f.rawHandler)
 	r.HandleFunc("/align/{cluster}/{keyspace}/{cf}/{op}", f.alignHandler)
+	r.HandleFunc("/anomalies/{cluster}/{keyspace}/{cf}/{op}", f.anomalyHandler).Methods("GET")
+	r.HandleFunc("/export", f.exportHandler).Methods("GET")
 	r.PathPrefix("/test").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusFound)
 		fmt.Fprintf(w, "Welcome to the home page!\n")
@@ -202,15 +512,116 @@ func main() {
 	})
 	r.HandleFunc("/clusters", f.listClusters)
 	r.HandleFunc("/clusters/{cluster}", f.showCluster)
-	r.PathPrefix("/static").Handler(http.StripPrefix("/static", http.FileServer(http.Dir("static"))))
+	r.HandleFunc("/meters", f.listMeters).Methods("GET")
+	r.HandleFunc("/meters/{cluster}/{keyspace}/{cf}/{op}", f.deleteMeter).Methods("DELETE")
+	r.HandleFunc("/save", f.saveHandler).Methods("POST")
+	r.HandleFunc("/federation", f.federationHandler).Methods("GET")
+	r.HandleFunc("/relays", f.relayHandler).Methods("GET")
+	r.HandleFunc("/alerts", f.alertsHandler).Methods("GET")
+	r.HandleFunc("/annotations", f.addAnnotation).Methods("POST")
+	r.HandleFunc("/annotations", f.listAnnotations).Methods("GET")
+	r.HandleFunc("/annotations/{id}", f.deleteAnnotation).Methods("DELETE")
+	handleNamed(r, "/dashboards", f.U.Dashboards)
+	r.HandleFunc("/aggregate", f.aggregateHandler).Methods("GET")
+	r.HandleFunc("/contributions", f.contributionsHandler).Methods("GET")
+	handleNamed(r, "/slos", f.U.SLOs)
+	r.HandleFunc("/slos/{name}/report", f.sloReport).Methods("GET")
+	r.HandleFunc("/static/labels.js", labelsJS).Methods("GET")
+	r.PathPrefix("/static").Handler(http.StripPrefix("/static", http.FileServer(f.staticFS())))
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/static/play.html", http.StatusFound)
+		http.Redirect(w, r, "/static/browse.html", http.StatusFound)
 		return
 	})
-	http.Handle("/", handlers.LoggingHandler(os.Stdout, r))
-	http.ListenAndServe(":4270", nil)
+	return r
+}
 
-	for {
-		time.Sleep(100 * time.Second)
+func main() {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [dump-config]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	config, err := loadConfig(fs, os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration : %s\n", err)
+		os.Exit(-1)
+	}
+	switch fs.Arg(0) {
+	case "":
+	case "dump-config":
+		out, err := config.Dump()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to dump configuration : %s\n", err)
+			os.Exit(-1)
+		}
+		os.Stdout.Write(out)
+		if err := config.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid configuration : %s\n", err)
+			os.Exit(-1)
+		}
+		return
+	default:
+		fs.Usage()
+		os.Exit(-1)
+	}
+	if err := config.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration : %s\n", err)
+		os.Exit(-1)
+	}
+
+	f := frankserver{
+		config,
+		frank.NewUtilityWithConfig(config.Utility),
+		make(chan frank.NamedSample),
+		make(chan frank.NamedSample),
+		config.PrintIncoming,
+		nil,
+		nil,
+		nil,
+		nil,
+	}
+	if len(config.Peers) > 0 {
+		f.Fed = newFederation(config.Peers, config.PeerTimeout)
+	}
+	for _, dst := range config.Relays {
+		r := newRelay(dst, config.RelayQueue)
+		f.Relays = append(f.Relays, r)
+		go r.run()
+	}
+	if len(config.Alerts.Rules) > 0 {
+		f.Alerts = newAlertEngine(config.Alerts, f.U)
+		go f.Alerts.run()
+	}
+	if err := f.U.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load saved state : %s\n", err)
+	}
+	if config.RecordFile != "" {
+		rec, err := openRecording(config.RecordFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to record : %s\n", err)
+			os.Exit(-1)
+		}
+		defer rec.Close()
+		f.Recorder = frank.NewRecorder(rec)
+	}
+
+	go f.CollectorListen()
+	go f.Store()
+	go f.PrintIncoming()
+	go func(){
+		for _ = range time.Tick(f.Config.SaveInterval) {
+			fmt.Printf("Save\n")
+			if err := f.U.Save(); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to save : %s\n", err)
+			}
+			fmt.Printf("Done\n")
+		}
+	}()
+
+	r := f.router()
+	http.Handle("/", handlers.LoggingHandler(os.Stdout, r))
+	if err := http.ListenAndServe(f.Config.HTTPListen, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to serve HTTP on %s : %s\n", f.Config.HTTPListen, err)
+		os.Exit(-1)
 	}
 }
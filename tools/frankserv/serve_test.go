@@ -0,0 +1,915 @@
+package main
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"github.com/cmceniry/frank"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) *frankserver {
+	c := DefaultConfig()
+	c.Utility.SaveFile = t.TempDir() + "/frank.sav"
+	f := &frankserver{
+		c,
+		frank.NewUtilityWithConfig(c.Utility),
+		make(chan frank.NamedSample),
+		make(chan frank.NamedSample),
+		false,
+		nil,
+		nil,
+		nil,
+		nil,
+	}
+	go f.Store()
+	go f.PrintIncoming()
+	return f
+}
+
+// sendSamples streams count samples, 5s apart and ending now, of a meter
+// whose bucket x grows by x each interval.
+func sendSamples(t *testing.T, addr string, name string, count int) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Unable to connect to collector port: %s", err)
+	}
+	defer conn.Close()
+	enc := gob.NewEncoder(conn)
+	now := (time.Now().Unix() / 5) * 5 * 1000
+	for x := 0; x < count; x++ {
+		data := make([]float64, len(frank.Labels))
+		for y := range data {
+			data[y] = float64(x * y)
+		}
+		s := frank.NamedSample{Sample: frank.Sample{TimestampMS: now - int64(count-1-x)*5000, Data: data}, Name: name}
+		if err := enc.Encode(s); err != nil {
+			t.Fatalf("Unable to send sample: %s", err)
+		}
+	}
+}
+
+func waitSamples(t *testing.T, f *frankserver, cluster, node, cf, op string, count int) *frank.Meter {
+	for x := 0; x < 100; x++ {
+		if m, err := f.U.GetMeter(cluster, node, cf, op); err == nil {
+			if raw, _ := m.Raw(); len(raw) == count {
+				return m
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Samples for %s:%s:%s:%s never arrived", cluster, node, cf, op)
+	return nil
+}
+
+func TestCollectorToAlign(t *testing.T) {
+	f := newTestServer(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	go f.serveCollectors(ln)
+	defer ln.Close()
+
+	sendSamples(t, ln.Addr().String(), "TestCluster:localhost:Space1.Test1:WriteLatency", 10)
+	waitSamples(t, f, "TestCluster", "localhost", "Space1.Test1", "WriteLatency", 10)
+
+	srv := httptest.NewServer(f.router())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/align/TestCluster/localhost/Space1.Test1/WriteLatency")
+	if err != nil {
+		t.Fatalf("Unable to get /align: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Invalid status : %d, should be 200", resp.StatusCode)
+	}
+	var aligned []frank.Sample
+	if err := json.NewDecoder(resp.Body).Decode(&aligned); err != nil {
+		t.Fatalf("Unable to decode /align: %s", err)
+	}
+	found := 0
+	for _, s := range aligned {
+		if s.Data[3] == 3 {
+			found++
+		}
+	}
+	// Align stops before the newest sample, so 10 samples give 8 differences.
+	if found != 8 {
+		t.Errorf("Invalid aligned intervals with data : %d, should be 8", found)
+	}
+
+	resp, err = http.Get(srv.URL + "/clusters")
+	if err != nil {
+		t.Fatalf("Unable to get /clusters: %s", err)
+	}
+	defer resp.Body.Close()
+	var clusters []string
+	json.NewDecoder(resp.Body).Decode(&clusters)
+	if len(clusters) != 1 || clusters[0] != "TestCluster" {
+		t.Errorf("Invalid clusters : %v, should be [TestCluster]", clusters)
+	}
+}
+
+func TestClusterHosts(t *testing.T) {
+	f := newTestServer(t)
+	node := frank.NodeInfo{HostID: "11111111-2222-3333-4444-555555555555", Address: "10.0.0.1", Datacenter: "dc1", Rack: "rack1"}
+	f.Storer <- frank.NamedSample{
+		Sample: frank.Sample{TimestampMS: 1410000000000, Data: make([]float64, len(frank.Labels))},
+		Name:   "TestCluster:" + node.HostID + ":Space1.Test1:WriteLatency",
+		Node:   &node,
+	}
+	waitSamples(t, f, "TestCluster", node.HostID, "Space1.Test1", "WriteLatency", 1)
+
+	srv := httptest.NewServer(f.router())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/clusters/TestCluster")
+	if err != nil {
+		t.Fatalf("Unable to get /clusters/TestCluster: %s", err)
+	}
+	defer resp.Body.Close()
+	var ci clusterInfo
+	if err := json.NewDecoder(resp.Body).Decode(&ci); err != nil {
+		t.Fatalf("Unable to decode /clusters/TestCluster: %s", err)
+	}
+	if len(ci.Nodes) != 1 || ci.Nodes[0] != node.HostID {
+		t.Errorf("Invalid nodes : %v, should be [%s]", ci.Nodes, node.HostID)
+	}
+	if ci.Hosts[node.HostID] != node {
+		t.Errorf("Invalid host info : %v, should be %v", ci.Hosts[node.HostID], node)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	f := newTestServer(t)
+	filename := t.TempDir() + "/frank.rec"
+	ioutil.WriteFile(filename, []byte("old"), 0644)
+	rec, err := openRecording(filename)
+	if err != nil {
+		t.Fatalf("openRecording produced error: %s", err)
+	}
+	defer rec.Close()
+	if old, _ := filepath.Glob(filename + ".*"); len(old) != 1 {
+		t.Errorf("Previous recording not moved aside : %v", old)
+	}
+	f.Recorder = frank.NewRecorder(rec)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	go f.serveCollectors(ln)
+	defer ln.Close()
+
+	sendSamples(t, ln.Addr().String(), "TestCluster:localhost:Space1.Test1:WriteLatency", 3)
+	waitSamples(t, f, "TestCluster", "localhost", "Space1.Test1", "WriteLatency", 3)
+
+	rec.Seek(0, 0)
+	p := frank.NewPlayback(rec)
+	for x := 0; x < 3; x++ {
+		s, err := p.Next()
+		if err != nil {
+			t.Fatalf("Recording has %d samples, should be 3: %s", x, err)
+		}
+		if s.Data[1] != float64(x) {
+			t.Errorf("Invalid recorded sample %d : %v", x, s.Data[:2])
+		}
+	}
+}
+
+func TestAdminEndpoints(t *testing.T) {
+	f := newTestServer(t)
+	f.U.NewMeter("TestCluster", "localhost", "Space1.Test1", "WriteLatency")
+	f.U.NewMeter("TestCluster", "localhost", "Space1.Test1", "ReadLatency")
+	f.U.NewMeter("OtherCluster", "localhost", "Space1.Test1", "ReadLatency")
+	srv := httptest.NewServer(f.router())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/meters?cluster=TestCluster")
+	if err != nil {
+		t.Fatalf("Unable to get /meters: %s", err)
+	}
+	var meters []string
+	json.NewDecoder(resp.Body).Decode(&meters)
+	resp.Body.Close()
+	if len(meters) != 2 || meters[0] != "TestCluster:localhost:Space1.Test1:ReadLatency" {
+		t.Errorf("Invalid meters : %v", meters)
+	}
+
+	req, _ := http.NewRequest("DELETE", srv.URL+"/meters/TestCluster/localhost/Space1.Test1/ReadLatency", nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Invalid delete response : %v, %v", resp, err)
+	}
+	if f.U.SizeMeters() != 2 {
+		t.Errorf("Invalid Meter Size after delete : %d, should be 2", f.U.SizeMeters())
+	}
+	if resp, _ := http.DefaultClient.Do(req); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Invalid status deleting a missing meter : %d, should be 404", resp.StatusCode)
+	}
+
+	if resp, err := http.Post(srv.URL+"/save", "", nil); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Invalid save response : %v, %v", resp, err)
+	}
+	u := frank.NewUtilityWithConfig(f.U.Config)
+	u.Load()
+	if u.SizeMeters() != 2 {
+		t.Errorf("Invalid Meter Size after save : %d, should be 2", u.SizeMeters())
+	}
+
+	resp, err = http.Get(srv.URL + "/align/TestCluster/localhost/Space1.Test1/WriteLatency?start=1410000000&end=1410000600&interval=60")
+	if err != nil {
+		t.Fatalf("Unable to get /align: %s", err)
+	}
+	var aligned []frank.Sample
+	json.NewDecoder(resp.Body).Decode(&aligned)
+	resp.Body.Close()
+	if len(aligned) != 10 || aligned[0].TimestampMS != 1410000000000 {
+		t.Errorf("Invalid aligned range : %d samples from %d", len(aligned), aligned[0].TimestampMS)
+	}
+	resp, _ = http.Get(srv.URL + "/align/TestCluster/localhost/Space1.Test1/WriteLatency?start=1410000600&end=1410000000")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Invalid status for reversed range : %d, should be 400", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/static/labels.js")
+	if err != nil {
+		t.Fatalf("Unable to get labels.js: %s", err)
+	}
+	js, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if lines := strings.Split(strings.TrimSpace(string(js)), "\n"); len(lines) != len(frank.Labels)+2 || lines[1] != "\t\"1\"," || lines[len(lines)-2] != "\t\"Higher\"" {
+		t.Errorf("Invalid labels.js : %q", js)
+	}
+	resp, err = http.Get(srv.URL + "/static/play.html")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Invalid response for the embedded play.html : %v, %v", resp, err)
+	}
+	resp, err = http.Get(srv.URL + "/static/vendor/d3.v3.min.js")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Invalid response for the embedded d3.v3.min.js : %v, %v", resp, err)
+	}
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	if resp, err := noRedirect.Get(srv.URL + "/"); err != nil || resp.Header.Get("Location") != "/static/browse.html" {
+		t.Errorf("Invalid redirect from / : %v, %v", resp, err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	f := newTestServer(t)
+	for x := 0; x < 3; x++ {
+		data := make([]float64, len(frank.Labels))
+		data[3] = float64(x * 10)
+		for _, op := range []string{"ReadLatency", "WriteLatency"} {
+			f.U.NewMeter("TestCluster", "localhost", "Space1.Test1", op)
+			f.U.AddSample("TestCluster", "localhost", "Space1.Test1", op, frank.Sample{TimestampMS: int64(1410000000+60*x) * 1000, Data: data})
+		}
+	}
+	srv := httptest.NewServer(f.router())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/export?format=jsonl&meter=*:WriteLatency&start=1410000060")
+	if err != nil {
+		t.Fatalf("Unable to get /export: %s", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if resp.Header.Get("Content-Type") != "application/x-ndjson" || len(lines) != 3 || !strings.Contains(lines[1], `"timestamp_ms":1410000060000`) {
+		t.Errorf("Invalid jsonl export : %s %q", resp.Header.Get("Content-Type"), lines)
+	}
+
+	resp, err = http.Get(srv.URL + "/export?format=columnar&start=1410000000&end=1410000120&interval=60")
+	if err != nil {
+		t.Fatalf("Unable to get /export: %s", err)
+	}
+	c, err := frank.ReadColumnar(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Unable to read columnar export: %s", err)
+	}
+	if len(c.Meters) != 2 || len(c.TimestampMS) != 4 || c.Buckets[3][0] != 10 {
+		t.Errorf("Invalid columnar export : %v %v %v", c.Meters, c.TimestampMS, c.Buckets[3])
+	}
+
+	for _, q := range []string{"format=parquet", "meter=[", "start=later"} {
+		if resp, _ := http.Get(srv.URL + "/export?" + q); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Invalid status for %s : %d, should be 400", q, resp.StatusCode)
+		}
+	}
+}
+
+func TestFederation(t *testing.T) {
+	local, peer := newTestServer(t), newTestServer(t)
+	for x := 0; x < 5; x++ {
+		data := make([]float64, len(frank.Labels))
+		data[3] = float64(x)
+		local.U.NewMeter("TestCluster", "dc1node", "Space1.Test1", "ReadLatency")
+		local.U.AddSample("TestCluster", "dc1node", "Space1.Test1", "ReadLatency", frank.Sample{TimestampMS: int64(1410000000+60*x) * 1000, Data: data})
+		// The collector of shared failed over from local to peer after
+		// the third sample, which both hold.
+		for n, s := range []*frankserver{local, peer} {
+			if (n == 0 && x > 2) || (n == 1 && x < 2) {
+				continue
+			}
+			s.U.NewMeter("TestCluster", "shared", "Space1.Test1", "ReadLatency")
+			s.U.AddSample("TestCluster", "shared", "Space1.Test1", "ReadLatency", frank.Sample{TimestampMS: int64(1410000000+60*x) * 1000, Data: data})
+		}
+		peer.U.NewMeter("OtherCluster", "dc2node", "Space1.Test1", "ReadLatency")
+	}
+	peerSrv := httptest.NewServer(peer.router())
+	defer peerSrv.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	local.Fed = newFederation([]string{peerSrv.URL, down.URL}, time.Second)
+	srv := httptest.NewServer(local.router())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/clusters")
+	if err != nil {
+		t.Fatalf("Unable to get /clusters: %s", err)
+	}
+	var clusters []string
+	json.NewDecoder(resp.Body).Decode(&clusters)
+	resp.Body.Close()
+	if len(clusters) != 2 || clusters[0] != "OtherCluster" {
+		t.Errorf("Invalid federated clusters : %v", clusters)
+	}
+	if h := resp.Header.Get(peerErrorHeader); !strings.Contains(h, down.URL) || strings.Contains(h, peerSrv.URL) {
+		t.Errorf("Invalid peer errors : %q", h)
+	}
+
+	resp, _ = http.Get(srv.URL + "/clusters/TestCluster?local=1")
+	var ci clusterInfo
+	json.NewDecoder(resp.Body).Decode(&ci)
+	resp.Body.Close()
+	if len(ci.Nodes) != 2 || resp.Header.Get(peerErrorHeader) != "" {
+		t.Errorf("Invalid local only cluster : %v", ci)
+	}
+
+	resp, _ = http.Get(srv.URL + "/align/TestCluster/shared/Space1.Test1/ReadLatency?start=1410000000&end=1410000300&interval=60")
+	var aligned []frank.Sample
+	json.NewDecoder(resp.Body).Decode(&aligned)
+	resp.Body.Close()
+	// One event a minute, as a single server holding every sample would
+	// answer; the newest sample only closes the last interval.
+	if len(aligned) != 5 || aligned[0].Data[3] != 1 || aligned[1].Data[3] != 1 || aligned[2].Data[3] != 1 || aligned[3].Data[3] != 0 {
+		t.Errorf("Invalid merged align : %v", aligned)
+	}
+	resp, _ = http.Get(srv.URL + "/align/OtherCluster/dc2node/Space1.Test1/ReadLatency?start=1410000000&end=1410000120&interval=60")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Invalid status for a peer only meter : %d, should be 200", resp.StatusCode)
+	}
+	resp, _ = http.Get(srv.URL + "/align/NoCluster/node/Space1.Test1/ReadLatency")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Invalid status for a missing meter : %d, should be 404", resp.StatusCode)
+	}
+
+	resp, _ = http.Get(srv.URL + "/federation")
+	var status []peerStatus
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if len(status) != 2 || !status[0].OK || status[1].OK || status[1].Error == "" {
+		t.Errorf("Invalid federation status : %v", status)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	primary, standby := newTestServer(t), newTestServer(t)
+	standbyLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	defer standbyLn.Close()
+	primaryLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	defer primaryLn.Close()
+
+	// Samples queue up while the standby is not listening yet.
+	r := newRelay(standbyLn.Addr().String(), 100)
+	primary.Relays = []*relay{r}
+	go primary.serveCollectors(primaryLn)
+	sendSamples(t, primaryLn.Addr().String(), "TestCluster:localhost:Space1.Test1:WriteLatency", 5)
+	waitSamples(t, primary, "TestCluster", "localhost", "Space1.Test1", "WriteLatency", 5)
+	if st := r.Status(); st.Queued != 5 || st.Sent != 0 {
+		t.Errorf("Invalid relay status before connecting : %+v", st)
+	}
+
+	go standby.serveCollectors(standbyLn)
+	go r.run()
+	waitSamples(t, standby, "TestCluster", "localhost", "Space1.Test1", "WriteLatency", 5)
+	if st := r.Status(); st.Sent != 5 || !st.Connected {
+		t.Errorf("Invalid relay status after connecting : %+v", st)
+	}
+
+	full := newRelay("127.0.0.1:1", 1)
+	full.Offer(frank.NamedSample{})
+	full.Offer(frank.NamedSample{})
+	if st := full.Status(); st.Queued != 1 || st.Dropped != 1 {
+		t.Errorf("Invalid status of a full relay : %+v", st)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	u := frank.NewUtility()
+	u.NewMeter("TestCluster", "localhost", "Space1.Test1", "WriteLatency")
+	slow, fast := frank.LabelIndex(65000), frank.LabelIndex(800)
+	total := make([]float64, len(frank.Labels))
+	for x := 0; x <= 60; x++ {
+		if x < 40 {
+			total[slow] += 10
+		} else {
+			total[fast] += 10
+		}
+		data := append([]float64{}, total...)
+		u.AddSample("TestCluster", "localhost", "Space1.Test1", "WriteLatency", frank.Sample{TimestampMS: int64(1410000000+5*x) * 1000, Data: data})
+	}
+
+	posted := make(chan alert, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a alert
+		json.NewDecoder(r.Body).Decode(&a)
+		posted <- a
+	}))
+	defer hook.Close()
+
+	c := DefaultAlertConfig()
+	c.Webhooks = []string{hook.URL}
+	c.Rules = []AlertRule{
+		{Name: "p99", Meter: "TestCluster:*:Space1.Test1:WriteLatency", Sum: true, Percentile: 99, Above: "50ms", For: 2 * time.Minute},
+		{Name: "tail", Meter: "TestCluster:*:*:WriteLatency", SlowerThan: 20 * time.Millisecond, Above: "5%"},
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Alert config should be valid: %s", err)
+	}
+	e := newAlertEngine(c, u)
+	states := func(at int64) map[string]string {
+		changed := e.evaluate(time.Unix(1410000000+at, 0))
+		e.deliver(changed)
+		ret := make(map[string]string)
+		for _, a := range changed {
+			ret[a.Rule] = a.State
+		}
+		return ret
+	}
+
+	if got := states(60); len(got) != 1 || got["tail"] != alertFiring {
+		t.Errorf("Invalid changes at 60s : %v", got)
+	}
+	if a := e.Alerts(); len(a) != 2 || a[0].Rule != "p99" || a[0].State != alertPending || a[0].Meter != c.Rules[0].Meter {
+		t.Errorf("Invalid alerts at 60s : %+v", a)
+	}
+	if got := states(120); len(got) != 0 {
+		t.Errorf("Invalid changes at 120s : %v", got)
+	}
+	if got := states(180); len(got) != 1 || got["p99"] != alertFiring {
+		t.Errorf("Invalid changes at 180s : %v", got)
+	}
+	if got := states(300); len(got) != 2 || got["p99"] != alertResolved || got["tail"] != alertResolved {
+		t.Errorf("Invalid changes at 300s : %v", got)
+	}
+	if len(e.Alerts()) != 0 {
+		t.Errorf("Resolved alerts should be cleared : %+v", e.Alerts())
+	}
+
+	close(posted)
+	count := 0
+	for a := range posted {
+		if a.Rule == "p99" && a.State == alertFiring && a.Description != "p99 73.5ms > 50.0ms" {
+			t.Errorf("Invalid p99 description : %q", a.Description)
+		}
+		count++
+	}
+	if count != 4 {
+		t.Errorf("Invalid webhook posts : %d, should be 4", count)
+	}
+
+	c.Rules = append(c.Rules, AlertRule{Name: "bad", Meter: "*", Percentile: 99, Above: "5%"})
+	if err := c.Validate(); err == nil {
+		t.Errorf("A percentile rule with a fractional threshold should not be valid")
+	}
+}
+
+func TestAlertsNewMeter(t *testing.T) {
+	u := frank.NewUtility()
+	u.NewMeter("TestCluster", "10.0.0.9", "Space1.Test1", "WriteLatency")
+	// A node first seen half way through the window, with a long history
+	// of slow writes and only fast ones since.
+	total := make([]float64, len(frank.Labels))
+	total[frank.LabelIndex(900000)] = 1e6
+	for x := 6; x <= 12; x++ {
+		total[frank.LabelIndex(800)] += 100
+		u.AddSample("TestCluster", "10.0.0.9", "Space1.Test1", "WriteLatency", frank.Sample{TimestampMS: int64(1410000000+5*x) * 1000, Data: append([]float64{}, total...)})
+	}
+	c := DefaultAlertConfig()
+	c.Webhooks = []string{"http://127.0.0.1:1/"}
+	c.Rules = []AlertRule{{Name: "p99", Meter: "TestCluster:*:*:WriteLatency", Percentile: 99, Above: "50ms"}}
+	e := newAlertEngine(c, u)
+	changed := e.evaluate(time.Unix(1410000060, 0))
+	if len(changed) != 0 {
+		t.Errorf("Invalid alerts for a new meter : %+v", changed)
+	}
+	m, _ := u.GetMeter("TestCluster", "10.0.0.9", "Space1.Test1", "WriteLatency")
+	if data := e.window([]*frank.Meter{m}, time.Minute, time.Unix(1410000060, 0)); frank.Count(data) != 600 {
+		t.Errorf("Invalid window count : %g, should be 600", frank.Count(data))
+	}
+
+	// Queueing alerts for a dead webhook must not wait on it.
+	began := time.Now()
+	e.notify([]alert{{Rule: "p99"}, {Rule: "p99"}})
+	if time.Since(began) > time.Second || len(e.queue) != 2 {
+		t.Errorf("Invalid notify : took %s, queued %d", time.Since(began), len(e.queue))
+	}
+}
+
+func TestAnomalies(t *testing.T) {
+	f := newTestServer(t)
+	f.U.NewMeter("TestCluster", "localhost", "Space1.Test1", "ReadLatency")
+	usual, odd := frank.LabelIndex(800), frank.LabelIndex(5000)
+	total := make([]float64, len(frank.Labels))
+	start := int64(1410000000)
+	for x := int64(0); x <= 2*day/60+10; x++ {
+		// A minute a day, two days apart, reads are much slower.
+		if x == 100 || x == day/60+100 || x == 2*day/60+5 {
+			total[odd] += 50
+		} else {
+			total[usual] += 50
+		}
+		data := append([]float64{}, total...)
+		f.U.AddSample("TestCluster", "localhost", "Space1.Test1", "ReadLatency", frank.Sample{TimestampMS: (start + 60*x) * 1000, Data: data})
+	}
+	srv := httptest.NewServer(f.router())
+	defer srv.Close()
+
+	get := func(query string) []frank.Anomaly {
+		resp, err := http.Get(srv.URL + "/anomalies/TestCluster/localhost/Space1.Test1/ReadLatency?" + query)
+		if err != nil {
+			t.Fatalf("Unable to get /anomalies: %s", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Invalid status for %s : %d", query, resp.StatusCode)
+		}
+		var ret []frank.Anomaly
+		json.NewDecoder(resp.Body).Decode(&ret)
+		return ret
+	}
+	anomalous := func(as []frank.Anomaly) []int64 {
+		ret := make([]int64, 0)
+		for _, a := range as {
+			if a.Anomalous {
+				ret = append(ret, (a.TimestampMS/1000-start)/60)
+			}
+		}
+		return ret
+	}
+
+	end := start + 2*day + 10*60
+	ewma := get(fmt.Sprintf("start=%d&end=%d&interval=60", end-20*60, end))
+	// Diff labels each interval with its start, the sample before the change.
+	if got := anomalous(ewma); len(got) != 1 || got[0] != 2*day/60+4 {
+		t.Errorf("Invalid ewma anomalies : %v", got)
+	}
+	// The slow minute at the same time the day before is not an anomaly.
+	daily := get(fmt.Sprintf("start=%d&end=%d&interval=60&baseline=daily&days=2&distance=kl", start+day+90*60, start+day+110*60))
+	if got := anomalous(daily); len(got) != 0 || !daily[0].Scored {
+		t.Errorf("Invalid daily anomalies : %v, %+v", got, daily[0])
+	}
+	for _, q := range []string{"baseline=weekly", "distance=chi2", "alpha=2"} {
+		resp, _ := http.Get(srv.URL + "/anomalies/TestCluster/localhost/Space1.Test1/ReadLatency?" + q)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Invalid status for %s : %d, should be 400", q, resp.StatusCode)
+		}
+	}
+}
+
+func TestAnnotationEndpoints(t *testing.T) {
+	f := newTestServer(t)
+	srv := httptest.NewServer(f.router())
+	defer srv.Close()
+
+	for _, body := range []string{
+		`{"timestamp_ms": 1410000000000, "cluster": "TestCluster", "text": "deploy v2.3", "tags": ["deploy"]}`,
+		`{"timestamp_ms": 1410000300000, "cluster": "TestCluster", "node": "localhost", "text": "repair"}`,
+		`{"timestamp_ms": 1410000600000, "cluster": "TestCluster", "node": "otherhost", "text": "restart"}`,
+	} {
+		resp, err := http.Post(srv.URL+"/annotations", "application/json", strings.NewReader(body))
+		if err != nil || resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Invalid annotation response : %v, %v", resp, err)
+		}
+		resp.Body.Close()
+	}
+	resp, _ := http.Post(srv.URL+"/annotations", "application/json", strings.NewReader(`{"cluster": "TestCluster"}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Invalid status for an annotation without text : %d, should be 400", resp.StatusCode)
+	}
+
+	list := func(query string) []frank.Annotation {
+		resp, err := http.Get(srv.URL + "/annotations?" + query)
+		if err != nil {
+			t.Fatalf("Unable to get /annotations: %s", err)
+		}
+		defer resp.Body.Close()
+		var ret []frank.Annotation
+		json.NewDecoder(resp.Body).Decode(&ret)
+		return ret
+	}
+	if got := list("cluster=TestCluster&node=localhost&end=1410000600"); len(got) != 2 || got[1].Text != "repair" {
+		t.Errorf("Invalid annotations for localhost : %v", got)
+	}
+	if got := list("cluster=TestCluster&start=1410000300"); len(got) != 2 || got[0].ID != 2 {
+		t.Errorf("Invalid annotations since 1410000300 : %v", got)
+	}
+
+	req, _ := http.NewRequest("DELETE", srv.URL+"/annotations/1", nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Invalid delete response : %v, %v", resp, err)
+	}
+	if resp, _ := http.DefaultClient.Do(req); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Invalid status deleting a missing annotation : %d, should be 404", resp.StatusCode)
+	}
+	if got := list(""); len(got) != 2 {
+		t.Errorf("Invalid annotations after delete : %v", got)
+	}
+}
+
+func TestSLOEndpoints(t *testing.T) {
+	f := newTestServer(t)
+	srv := httptest.NewServer(f.router())
+	defer srv.Close()
+	now := time.Now().UnixNano() / 1e6
+	total := make([]float64, len(frank.Labels))
+	f.U.NewMeter("TestCluster", "localhost", "Space1.Test1", "WriteLatency")
+	for x := int64(60); x >= 0; x-- {
+		total[frank.LabelIndex(1000)] += 95
+		total[frank.LabelIndex(50000)] += 5
+		f.U.AddSample("TestCluster", "localhost", "Space1.Test1", "WriteLatency", frank.Sample{TimestampMS: now - x*60000, Data: append([]float64{}, total...)})
+	}
+
+	put := func(name, body string) int {
+		req, _ := http.NewRequest("PUT", srv.URL+"/slos/"+name, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unable to put /slos/%s: %s", name, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	slo := `{"meter": "TestCluster:*:*:WriteLatency", "objective": 0.99, "threshold": "10ms", "window": "720h"}`
+	if code := put("writes", slo); code != http.StatusCreated {
+		t.Errorf("Invalid status creating an SLO : %d, should be 201", code)
+	}
+	if code := put("writes", slo); code != http.StatusOK {
+		t.Errorf("Invalid status replacing an SLO : %d, should be 200", code)
+	}
+	if code := put("bad", `{"meter": "*", "objective": 99}`); code != http.StatusBadRequest {
+		t.Errorf("Invalid status for a bad SLO : %d, should be 400", code)
+	}
+	resp, err := http.Get(srv.URL + "/slos/writes")
+	if err != nil {
+		t.Fatalf("Unable to get /slos/writes: %s", err)
+	}
+	var got frank.SLO
+	json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if got.Name != "writes" || got.Window != "720h" {
+		t.Errorf("Invalid SLO : %+v", got)
+	}
+
+	resp, err = http.Get(srv.URL + "/slos/writes/report?windows=1h,5m")
+	if err != nil {
+		t.Fatalf("Unable to get the report: %s", err)
+	}
+	var report frank.SLOReport
+	json.NewDecoder(resp.Body).Decode(&report)
+	resp.Body.Close()
+	if len(report.Windows) != 3 || report.Windows[0].Total != 6000 || report.Windows[0].Attainment > 0.951 || report.Windows[2].BurnRate < 4.99 {
+		t.Errorf("Invalid report : %+v", report)
+	}
+	if resp, _ := http.Get(srv.URL + "/slos/writes/report?windows=soon"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Invalid status for a bad window : %d, should be 400", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("DELETE", srv.URL+"/slos/writes", nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Invalid delete response : %v, %v", resp, err)
+	}
+	if resp, _ := http.Get(srv.URL + "/slos/writes/report"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Invalid status for a deleted SLO : %d, should be 404", resp.StatusCode)
+	}
+}
+
+func TestDashboardEndpoints(t *testing.T) {
+	f := newTestServer(t)
+	srv := httptest.NewServer(f.router())
+	defer srv.Close()
+	for n, node := range []string{"host1", "host2"} {
+		f.U.NewMeter("TestCluster", node, "Space1.Test1", "WriteLatency")
+		for x := int64(0); x <= 10; x++ {
+			data := make([]float64, len(frank.Labels))
+			data[10] = float64(x * int64(n+1))
+			f.U.AddSample("TestCluster", node, "Space1.Test1", "WriteLatency", frank.Sample{TimestampMS: (1410000000 + 60*x) * 1000, Data: data})
+		}
+	}
+
+	dash := `{"range": "1h", "interval": "1m", "panels": [{"type": "heatmap", "meter": "TestCluster:*:*:WriteLatency"}]}`
+	req, _ := http.NewRequest("PUT", srv.URL+"/dashboards/writes", strings.NewReader(dash))
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Invalid put response : %v, %v", resp, err)
+	}
+	req, _ = http.NewRequest("PUT", srv.URL+"/dashboards/bad", strings.NewReader(`{"range": "1h", "interval": "1m"}`))
+	if resp, _ := http.DefaultClient.Do(req); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Invalid status for a dashboard without panels : %d, should be 400", resp.StatusCode)
+	}
+	resp, err := http.Get(srv.URL + "/dashboards/writes")
+	if err != nil {
+		t.Fatalf("Unable to get /dashboards/writes: %s", err)
+	}
+	var d frank.Dashboard
+	json.NewDecoder(resp.Body).Decode(&d)
+	resp.Body.Close()
+	if d.Name != "writes" || len(d.Panels) != 1 {
+		t.Errorf("Invalid dashboard : %+v", d)
+	}
+
+	aggregate := func(how string) []frank.Sample {
+		resp, err := http.Get(srv.URL + "/aggregate?meter=TestCluster:*:*:WriteLatency&start=1410000000&end=1410000300&interval=60&aggregation=" + how)
+		if err != nil {
+			t.Fatalf("Unable to get /aggregate: %s", err)
+		}
+		defer resp.Body.Close()
+		var ret []frank.Sample
+		json.NewDecoder(resp.Body).Decode(&ret)
+		return ret
+	}
+	if got := aggregate("sum"); len(got) != 5 || got[0].Data[10] != 3 {
+		t.Errorf("Invalid sum : %v", got)
+	}
+	if got := aggregate("max"); len(got) != 5 || got[0].Data[10] != 2 {
+		t.Errorf("Invalid max : %v", got)
+	}
+	if resp, _ := http.Get(srv.URL + "/aggregate"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Invalid status without meters : %d, should be 400", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest("DELETE", srv.URL+"/dashboards/writes", nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Invalid delete response : %v, %v", resp, err)
+	}
+	if resp, _ := http.Get(srv.URL + "/dashboards/writes"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Invalid status for a deleted dashboard : %d, should be 404", resp.StatusCode)
+	}
+}
+
+func TestAlignNormalize(t *testing.T) {
+	f := newTestServer(t)
+	f.U.NewMeter("TestCluster", "localhost", "Space1.Test1", "WriteLatency")
+	total := make([]float64, len(frank.Labels))
+	for x := int64(0); x <= 10; x++ {
+		total[10] += 3
+		total[20] += 1
+		f.U.AddSample("TestCluster", "localhost", "Space1.Test1", "WriteLatency", frank.Sample{TimestampMS: (1410000000 + 60*x) * 1000, Data: append([]float64{}, total...)})
+	}
+	srv := httptest.NewServer(f.router())
+	defer srv.Close()
+	base := srv.URL + "/align/TestCluster/localhost/Space1.Test1/WriteLatency?start=1410000000&end=1410000600&interval=60"
+
+	resp, err := http.Get(base + "&normalize=fraction&stats=1")
+	if err != nil {
+		t.Fatalf("Unable to get /align: %s", err)
+	}
+	var got struct {
+		Normalize string
+		Samples   []frank.Sample
+		Stats     frank.ValueStats
+	}
+	json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if got.Normalize != "fraction" || len(got.Samples) != 10 || got.Samples[0].Data[10] != 0.75 {
+		t.Errorf("Invalid normalized samples : %+v", got)
+	}
+	// The newest interval is empty, as Align drops the newest sample.
+	if got.Stats.Cells != 18 || got.Stats.Max != 0.75 || got.Stats.Min != 0.25 {
+		t.Errorf("Invalid stats : %+v", got.Stats)
+	}
+
+	// Without stats the answer is the plain samples, as before.
+	resp, _ = http.Get(base + "&normalize=log")
+	var samples []frank.Sample
+	json.NewDecoder(resp.Body).Decode(&samples)
+	resp.Body.Close()
+	if len(samples) != 10 || samples[0].Data[20] != math.Log10(2) {
+		t.Errorf("Invalid log samples : %v", samples)
+	}
+	if resp, _ := http.Get(base + "&normalize=sqrt"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Invalid status for an unknown normalization : %d, should be 400", resp.StatusCode)
+	}
+}
+
+func TestAlignBuckets(t *testing.T) {
+	f := newTestServer(t)
+	f.U.NewMeter("TestCluster", "localhost", "Space1.Test1", "WriteLatency")
+	total := make([]float64, len(frank.Labels))
+	for x := int64(0); x <= 10; x++ {
+		total[frank.LabelIndex(500)] += 1
+		total[frank.LabelIndex(5000)] += 2
+		total[frank.LabelIndex(50000)] += 4
+		f.U.AddSample("TestCluster", "localhost", "Space1.Test1", "WriteLatency", frank.Sample{TimestampMS: (1410000000 + 60*x) * 1000, Data: append([]float64{}, total...)})
+	}
+	srv := httptest.NewServer(f.router())
+	defer srv.Close()
+	get := func(query string) (int, alignedRows) {
+		resp, err := http.Get(srv.URL + "/align/TestCluster/localhost/Space1.Test1/WriteLatency?start=1410000000&end=1410000600&interval=60&" + query)
+		if err != nil {
+			t.Fatalf("Unable to get /align: %s", err)
+		}
+		defer resp.Body.Close()
+		var ret alignedRows
+		json.NewDecoder(resp.Body).Decode(&ret)
+		return resp.StatusCode, ret
+	}
+
+	_, got := get("bounds=1ms,10ms,100ms,1s")
+	if len(got.Labels) != 5 || got.Labels[0] != 1109 || got.Labels[4] != math.MaxFloat64 || got.Stats != nil {
+		t.Errorf("Invalid bounds : %v", got.Labels)
+	}
+	if d := got.Samples[0].Data; len(d) != 5 || d[0] != 1 || d[1] != 2 || d[2] != 4 || d[3] != 0 {
+		t.Errorf("Invalid rows : %v", d)
+	}
+	// The 500us events fall below min.
+	_, got = get("min=1ms&max=100ms&rows=4&normalize=fraction&stats=1")
+	if len(got.Labels) != 4 || got.Labels[3] != frank.Labels[frank.LabelIndex(100000)] || got.Samples[0].Data[1] != 1.0/3 || got.Stats == nil {
+		t.Errorf("Invalid cropped rows : %v, %v", got.Labels, got.Samples[0].Data)
+	}
+	_, got = get("trim=1")
+	if len(got.Labels) != frank.LabelIndex(50000)-frank.LabelIndex(500)+1 || got.Labels[0] != frank.Labels[frank.LabelIndex(500)] {
+		t.Errorf("Invalid trimmed labels : %v", got.Labels)
+	}
+	for _, q := range []string{"rows=0", "bounds=fast", "min=10ms&max=1ms", "rows=3&bounds=1ms"} {
+		if code, _ := get(q); code != http.StatusBadRequest {
+			t.Errorf("Invalid status for %s : %d, should be 400", q, code)
+		}
+	}
+}
+
+func TestContributionEndpoint(t *testing.T) {
+	f := newTestServer(t)
+	for n, node := range []string{"host1", "host2", "host3"} {
+		for _, cf := range []string{"Space1.Test1", "Space1.Test2"} {
+			f.U.NewMeter("TestCluster", node, cf, "ReadLatency")
+			total := make([]float64, len(frank.Labels))
+			for x := int64(0); x <= 10; x++ {
+				total[frank.LabelIndex(500)] += 10
+				// host2 is slow in the fifth minute.
+				if x == 5 && node == "host2" {
+					total[frank.LabelIndex(50000)] += 6
+				} else if x == 5 {
+					total[frank.LabelIndex(50000)] += float64(n)
+				}
+				f.U.AddSample("TestCluster", node, cf, "ReadLatency", frank.Sample{TimestampMS: (1410000000 + 60*x) * 1000, Data: append([]float64{}, total...)})
+			}
+		}
+	}
+	srv := httptest.NewServer(f.router())
+	defer srv.Close()
+	get := func(query string) (int, []frank.Contribution) {
+		resp, err := http.Get(srv.URL + "/contributions?meter=TestCluster:*:*:ReadLatency&interval=60&" + query)
+		if err != nil {
+			t.Fatalf("Unable to get /contributions: %s", err)
+		}
+		defer resp.Body.Close()
+		var ret []frank.Contribution
+		json.NewDecoder(resp.Body).Decode(&ret)
+		return resp.StatusCode, ret
+	}
+
+	// Diff labels the slow events with the minute before they were counted.
+	_, got := get("start=1410000240&end=1410000300&min=10ms&max=100ms")
+	if len(got) != 3 || got[0].Key != "host2" || got[0].Count != 12 || got[0].Share != 0.75 || got[0].Total != 32 {
+		t.Fatalf("Invalid contributions : %+v", got)
+	}
+	if got[2].Key != "host1" || got[2].Count != 0 {
+		t.Errorf("Invalid quiet node : %+v", got[2])
+	}
+	_, got = get("start=1410000240&end=1410000300&min=10ms&by=cf")
+	if len(got) != 2 || got[0].Count != 8 {
+		t.Errorf("Invalid contributions by cf : %+v", got)
+	}
+	for _, q := range []string{"by=rack", "min=fast", "start=1410000300&end=1410000240"} {
+		if code, _ := get(q); code != http.StatusBadRequest {
+			t.Errorf("Invalid status for %s : %d, should be 400", q, code)
+		}
+	}
+}
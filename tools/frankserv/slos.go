@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/cmceniry/frank"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sloReport reports the SLO over its own window and the comma separated
+// burn rate windows, frank.DefaultBurnWindows by default.
+func (f *frankserver) sloReport(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, ok := f.U.SLOs.Get(name); !ok {
+		http.Error(w, "Unknown SLO "+name, http.StatusNotFound)
+		return
+	}
+	windows := frank.DefaultBurnWindows
+	if v := r.URL.Query().Get("windows"); v != "" {
+		windows = nil
+		for _, s := range strings.Split(v, ",") {
+			d, err := time.ParseDuration(strings.TrimSpace(s))
+			if err != nil || d <= 0 {
+				http.Error(w, "Invalid window "+s, http.StatusBadRequest)
+				return
+			}
+			windows = append(windows, d)
+		}
+	}
+	report, err := f.U.ReportSLO(name, time.Now(), windows)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, report)
+}
@@ -3,22 +3,38 @@ package frank
 import (
   "time"
   "fmt"
+  "sort"
   "strings"
+  "sync"
+  "io"
+  "io/ioutil"
   "os"
+  "path"
+  "path/filepath"
   "encoding/gob"
 )
 
 type UtilityConfig struct {
-  BackgroundSleep int
-  BackgroundPause bool
-  BackgroundRunning bool
-  SampleThreshold int
-  SaveFile string
+  BackgroundSleep int `yaml:"background_sleep"`
+  BackgroundPause bool `yaml:"background_pause"`
+  BackgroundRunning bool `yaml:"-"`
+  SampleThreshold int `yaml:"sample_threshold"`
+  SaveFile string `yaml:"save_file"`
 }
 
+// Utility's methods are safe to call from several goroutines. mu guards the
+// Clusters, Nodes and Meters maps, the annotations, the SLOs and dashboards
+// Stores and node details; each Meter guards its own Data.
 type Utility struct {
   Config UtilityConfig
   Clusters map[string]*utilCluster
+  mu sync.RWMutex
+  annotations []Annotation
+  lastAnnotation int64
+  SLOs *Store[SLO]
+  Dashboards *Store[Dashboard]
+  hosts map[string]map[string]NodeInfo
+  unloaded map[string]error
 }
 
 type utilCluster struct {
@@ -29,25 +45,54 @@ type utilNode struct {
   Meters map[string]*Meter
 }
 
+func DefaultUtilityConfig() UtilityConfig {
+  return UtilityConfig{
+    30,
+    false,
+    false,
+    500,
+    "/tmp/frank.sav",
+  }
+}
+
 func NewUtility() *Utility {
+  return NewUtilityWithConfig(DefaultUtilityConfig())
+}
+
+func NewUtilityWithConfig(c UtilityConfig) *Utility {
   u := &Utility{
-    UtilityConfig{
-      30,
-      false,
-      false,
-      500,
-      "/tmp/frank.sav",
-    },
-    make(map[string]*utilCluster),
+    Config: c,
+    Clusters: make(map[string]*utilCluster),
+    hosts: make(map[string]map[string]NodeInfo),
+    unloaded: make(map[string]error),
   }
+  u.SLOs = newStore[SLO](u, "SLO", "slos")
+  u.Dashboards = newStore[Dashboard](u, "dashboard", "dashboards")
   return u
 }
 
+func (c UtilityConfig) Validate() error {
+  if c.BackgroundSleep <= 0 {
+    return fmt.Errorf("BackgroundSleep must be positive, got %d", c.BackgroundSleep)
+  }
+  if c.SampleThreshold <= 0 {
+    return fmt.Errorf("SampleThreshold must be positive, got %d", c.SampleThreshold)
+  }
+  if c.SaveFile == "" {
+    return fmt.Errorf("SaveFile must be set")
+  }
+  return nil
+}
+
 func (u *Utility) SizeClusters() int {
+  u.mu.RLock()
+  defer u.mu.RUnlock()
   return len(u.Clusters)
 }
 
 func (u *Utility) NewMeter(cluster string, node string, cf string, op string) (*Meter, error) {
+  u.mu.Lock()
+  defer u.mu.Unlock()
   c, ok := u.Clusters[cluster]
   if !ok {
     c = &utilCluster{make(map[string]*utilNode)}
@@ -62,12 +107,14 @@ func (u *Utility) NewMeter(cluster string, node string, cf string, op string) (*
   if _, ok := n.Meters[metername]; ok {
     return nil, fmt.Errorf("Meter already exists")
   }
-  m := &Meter{metername, make(map[int64]Sample)}
+  m := &Meter{Name: metername, Data: make(map[int64]Sample)}
   n.Meters[metername] = m
   return m, nil
 }
 
 func (u *Utility) SizeNodes() int {
+  u.mu.RLock()
+  defer u.mu.RUnlock()
   total := 0
   for _, c := range u.Clusters {
     total += len(c.Nodes)
@@ -76,6 +123,8 @@ func (u *Utility) SizeNodes() int {
 }
 
 func (u *Utility) SizeMeters() int {
+  u.mu.RLock()
+  defer u.mu.RUnlock()
   total := 0
   for _, c := range u.Clusters {
     for _, n := range c.Nodes {
@@ -86,6 +135,8 @@ func (u *Utility) SizeMeters() int {
 }
 
 func (u *Utility) ClusterNames() ([]string) {
+  u.mu.RLock()
+  defer u.mu.RUnlock()
   ret := make([]string, 0)
   for cname, _ := range u.Clusters {
     ret = append(ret, cname)
@@ -94,6 +145,8 @@ func (u *Utility) ClusterNames() ([]string) {
 }
 
 func (u *Utility) NodeNames(clustername string) ([]string) {
+  u.mu.RLock()
+  defer u.mu.RUnlock()
   ret := make([]string, 0)
   if c, ok := u.Clusters[clustername]; ok {
     for nname, _ := range c.Nodes {
@@ -104,6 +157,8 @@ func (u *Utility) NodeNames(clustername string) ([]string) {
 }
 
 func (u *Utility) CFNames(clustername string) ([]string) {
+  u.mu.RLock()
+  defer u.mu.RUnlock()
   ret := make([]string, 0)
   if c, ok := u.Clusters[clustername]; ok {
     for _, n := range c.Nodes {
@@ -128,6 +183,8 @@ func (u *Utility) CFNames(clustername string) ([]string) {
 }
 
 func (u *Utility) MeterNames() ([]string) {
+  u.mu.RLock()
+  defer u.mu.RUnlock()
   ret := make([]string, 0)
   for _, c := range u.Clusters {
     for _, n := range c.Nodes {
@@ -141,6 +198,8 @@ func (u *Utility) MeterNames() ([]string) {
 
 func (u *Utility) GetMeter(clustername string, nodename string, cf string, op string) (*Meter, error) {
   metername := fmt.Sprintf("%s:%s:%s:%s", clustername, nodename, cf, op)
+  u.mu.RLock()
+  defer u.mu.RUnlock()
   m, err := u.getMeter(clustername, nodename, metername)
   return m, err
 }
@@ -166,7 +225,7 @@ func (u *Utility) AddSample(clustername string, nodename string, cf string, op s
   if err != nil {
     return err
   }
-  m.Data[s.TimestampMS] = s
+  m.add(s)
   return nil
 }
 
@@ -183,12 +242,8 @@ func (u *Utility) backgroundCleanup() {
   for {
     if !u.Config.BackgroundPause && !u.Config.BackgroundRunning {
       u.Config.BackgroundRunning = true
-      for _, c := range u.Clusters {
-        for _, n := range c.Nodes {
-          for _, m := range n.Meters {
-            m.Cleanup(u.Config.SampleThreshold)
-          }
-        }
+      for _, m := range u.meters() {
+        m.Cleanup(u.Config.SampleThreshold)
       }
       u.Config.BackgroundRunning = false
     }
@@ -200,45 +255,227 @@ func (u *Utility) StartBackgroundClean() {
   go u.backgroundCleanup()
 }
 
-func (u *Utility) DeleteMeter(clustername string, nodename string, cf string, op string) {
+// DeleteMeter removes the meter, and its node and cluster if they are left
+// without any meters.
+func (u *Utility) DeleteMeter(clustername string, nodename string, cf string, op string) (error) {
+  metername := fmt.Sprintf("%s:%s:%s:%s", clustername, nodename, cf, op)
+  u.mu.Lock()
+  defer u.mu.Unlock()
+  if _, err := u.getMeter(clustername, nodename, metername); err != nil {
+    return err
+  }
+  c := u.Clusters[clustername]
+  n := c.Nodes[nodename]
+  delete(n.Meters, metername)
+  if len(n.Meters) == 0 {
+    delete(c.Nodes, nodename)
+  }
+  if len(c.Nodes) == 0 {
+    delete(u.Clusters, clustername)
+  }
+  return nil
+}
+
+// meters returns every meter sorted by name, for walking them without
+// holding the lock.
+func (u *Utility) meters() []*Meter {
+  u.mu.RLock()
+  defer u.mu.RUnlock()
+  ret := make([]*Meter, 0)
+  for _, c := range u.Clusters {
+    for _, n := range c.Nodes {
+      for _, m := range n.Meters {
+        ret = append(ret, m)
+      }
+    }
+  }
+  sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+  return ret
+}
 
+// MatchMeters returns the meters, sorted by name, whose cluster:node:cf:op
+// name matches any of the path.Match patterns.
+func (u *Utility) MatchMeters(patterns ...string) ([]*Meter, error) {
+  for _, p := range patterns {
+    if _, err := path.Match(p, ""); err != nil {
+      return nil, fmt.Errorf("Invalid meter pattern %q", p)
+    }
+  }
+  ret := make([]*Meter, 0)
+  for _, m := range u.meters() {
+    for _, p := range patterns {
+      if ok, _ := path.Match(p, m.Name); ok {
+        ret = append(ret, m)
+        break
+      }
+    }
+  }
+  return ret, nil
 }
 
-func (u *Utility) Load() (error) {
-  fi, err := os.Open(u.Config.SaveFile)
-  if err != nil {
-    return err
+// MergePolicy decides which sample to keep when a merge finds two for the
+// same meter and timestamp.
+type MergePolicy int
+
+const (
+  MergeReplace MergePolicy = iota // the incoming sample
+  MergeKeep                       // the sample already held
+  MergeMax                        // the sample with more events
+)
+
+func ParseMergePolicy(name string) (MergePolicy, error) {
+  switch name {
+  case "replace":
+    return MergeReplace, nil
+  case "keep":
+    return MergeKeep, nil
+  case "max":
+    return MergeMax, nil
   }
-  defer fi.Close()
-  dec := gob.NewDecoder(fi)
-  var m Meter
+  return 0, fmt.Errorf("Unknown merge policy %q : must be replace, keep or max", name)
+}
+
+// Merge adds every meter of a save file to u, creating meters as needed. It
+// returns the number of samples read and how many of them collided with a
+// sample already held.
+func (u *Utility) Merge(r io.Reader, policy MergePolicy) (int, int, error) {
+  samples, dups := 0, 0
+  dec := gob.NewDecoder(r)
   for {
+    // gob merges into an existing map, so every meter needs a fresh one
+    var m Meter
     err := dec.Decode(&m)
+    if err == io.EOF {
+      return samples, dups, nil
+    }
+    if err != nil {
+      return samples, dups, fmt.Errorf("Unable to decode meter: %s", err)
+    }
+    dst, err := u.meterFor(m.Name)
     if err != nil {
-      break
+      return samples, dups, err
     }
-    names := strings.Split(m.Name, ":")
-    u.NewMeter(names[0], names[1], names[2], names[3])
     for _, s := range m.Data {
-      u.AddSample(names[0], names[1], names[2], names[3], s)
+      samples++
+      if dst.merge(s, policy) {
+        dups++
+      }
+    }
+  }
+}
+
+// MergeSample adds a sample to the meter named cluster:node:cf:op, creating
+// it if needed, and reports whether it collided with a sample already held.
+func (u *Utility) MergeSample(name string, s Sample, policy MergePolicy) (bool, error) {
+  m, err := u.meterFor(name)
+  if err != nil {
+    return false, err
+  }
+  return m.merge(s, policy), nil
+}
+
+// meterFor returns the meter named cluster:node:cf:op, creating it if needed.
+func (u *Utility) meterFor(name string) (*Meter, error) {
+  names := strings.Split(name, ":")
+  if len(names) != 4 {
+    return nil, fmt.Errorf("Invalid meter name %q", name)
+  }
+  u.NewMeter(names[0], names[1], names[2], names[3])
+  return u.GetMeter(names[0], names[1], names[2], names[3])
+}
+
+// Load merges the meters of the save file and reads the annotations, SLOs,
+// dashboards and node details of its sidecar files. Each file is read on its own, so one
+// that cannot be read does not keep the others from loading, and missing
+// files are skipped. Save leaves a sidecar that failed to load alone rather
+// than replace it with an empty list.
+func (u *Utility) Load() (error) {
+  var errs []string
+  if err := u.loadMeters(); err != nil {
+    errs = append(errs, err.Error())
+  }
+  for _, load := range []func() error{u.loadAnnotations, u.SLOs.load, u.Dashboards.load, u.loadHosts} {
+    if err := load(); err != nil {
+      errs = append(errs, err.Error())
     }
   }
+  if len(errs) > 0 {
+    return fmt.Errorf("%s", strings.Join(errs, "; "))
+  }
   return nil
 }
 
-func (u *Utility) Save() (error) {
-  fi, err := os.Create(u.Config.SaveFile)
+func (u *Utility) loadMeters() (error) {
+  fi, err := os.Open(u.Config.SaveFile)
+  if os.IsNotExist(err) {
+    return nil
+  }
   if err != nil {
     return err
   }
   defer fi.Close()
-  enc := gob.NewEncoder(fi)
-  for _, c := range u.Clusters {
-    for _, n := range c.Nodes {
-      for _, m := range n.Meters {
-        enc.Encode(m)
+  if _, _, err = u.Merge(fi, MergeReplace); err != nil {
+    return fmt.Errorf("Unable to load %s: %s", u.Config.SaveFile, err)
+  }
+  return nil
+}
+
+// Save writes the meters to the save file and the rest to its sidecars.
+// Each file is written to a temporary file first and renamed over the old
+// one, so a crash part way leaves the previous save in place.
+func (u *Utility) Save() (error) {
+  var errs []string
+  err := writeFileAtomic(u.Config.SaveFile, func(w io.Writer) error {
+    enc := gob.NewEncoder(w)
+    for _, m := range u.meters() {
+      m.mu.RLock()
+      err := enc.Encode(m)
+      m.mu.RUnlock()
+      if err != nil {
+        return err
       }
     }
+    return nil
+  })
+  if err != nil {
+    errs = append(errs, err.Error())
+  }
+  for _, save := range []func() error{u.saveAnnotations, u.SLOs.save, u.Dashboards.save, u.saveHosts} {
+    if err := save(); err != nil {
+      errs = append(errs, err.Error())
+    }
+  }
+  if len(errs) > 0 {
+    return fmt.Errorf("%s", strings.Join(errs, "; "))
+  }
+  return nil
+}
+
+// writeFileAtomic replaces name with what write writes, through a
+// temporary file in the same directory.
+func writeFileAtomic(name string, write func(io.Writer) error) (error) {
+  tmp, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+  if err != nil {
+    return fmt.Errorf("Unable to save %s: %s", name, err)
+  }
+  defer os.Remove(tmp.Name())
+  if err := write(tmp); err != nil {
+    tmp.Close()
+    return fmt.Errorf("Unable to save %s: %s", name, err)
+  }
+  if err := tmp.Chmod(0644); err != nil {
+    tmp.Close()
+    return fmt.Errorf("Unable to save %s: %s", name, err)
+  }
+  if err := tmp.Sync(); err != nil {
+    tmp.Close()
+    return fmt.Errorf("Unable to save %s: %s", name, err)
+  }
+  if err := tmp.Close(); err != nil {
+    return fmt.Errorf("Unable to save %s: %s", name, err)
+  }
+  if err := os.Rename(tmp.Name(), name); err != nil {
+    return fmt.Errorf("Unable to save %s: %s", name, err)
   }
   return nil
 }
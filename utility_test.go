@@ -1,6 +1,14 @@
 package frank
 
-import "testing"
+import (
+  "bytes"
+  "encoding/gob"
+  "fmt"
+  "io/ioutil"
+  "path/filepath"
+  "strings"
+  "testing"
+)
 
 func TestNewUtility(t *testing.T) {
   u := NewUtility()
@@ -81,3 +89,127 @@ func TestUtilitySaveLoad(t * testing.T) {
     }
   }
 }
+
+func TestUtilityLoadDamaged(t *testing.T) {
+  c := DefaultUtilityConfig()
+  c.SaveFile = filepath.Join(t.TempDir(), "frank.sav")
+  u1 := NewUtilityWithConfig(c)
+  u1.NewMeter("Test Cluster", "localhost", "system.Test1", "WriteLatency")
+  u1.AddSample("Test Cluster", "localhost", "system.Test1", "WriteLatency", Sample{1410000000000, []float64{1.0}})
+  u1.AddAnnotation(Annotation{TimestampMS: 1000, Cluster: "Test Cluster", Text: "deploy"})
+  u1.SLOs.Put("writes", SLO{Meter: "Test Cluster:*:*:WriteLatency", Objective: 0.99, Threshold: "10ms", Window: "1h"})
+  if err := u1.Save(); err != nil {
+    t.Fatalf("Save produced error: %s", err)
+  }
+  if tmp, _ := filepath.Glob(c.SaveFile + "*.tmp*"); len(tmp) != 0 {
+    t.Errorf("Save left temporary files behind : %v", tmp)
+  }
+
+  // A save file cut short must not keep the sidecars from loading, and a
+  // sidecar that fails to load must not be saved over.
+  data, _ := ioutil.ReadFile(c.SaveFile)
+  ioutil.WriteFile(c.SaveFile, data[:len(data)/2], 0644)
+  ioutil.WriteFile(c.SaveFile+".slos", []byte("[{"), 0644)
+  u2 := NewUtilityWithConfig(c)
+  if err := u2.Load(); err == nil || !strings.Contains(err.Error(), c.SaveFile+".slos") {
+    t.Errorf("Invalid error loading damaged files : %v", err)
+  }
+  if got := u2.Annotations("", "", "", 0, 5000); len(got) != 1 {
+    t.Errorf("Invalid annotations after a damaged Load : %v", got)
+  }
+  if err := u2.Save(); err == nil {
+    t.Errorf("Saving over a sidecar that failed to load should produce an error")
+  }
+  if data, _ := ioutil.ReadFile(c.SaveFile + ".slos"); string(data) != "[{" {
+    t.Errorf("Invalid SLO sidecar after Save : %q, should be left alone", data)
+  }
+  if data, _ := ioutil.ReadFile(c.SaveFile + ".annotations"); !strings.Contains(string(data), "deploy") {
+    t.Errorf("Invalid annotation sidecar after Save : %q", data)
+  }
+
+  ioutil.WriteFile(c.SaveFile+".slos", []byte("[]"), 0644)
+  if err := u2.Load(); err != nil {
+    t.Errorf("Load produced error: %s", err)
+  }
+  if err := u2.Save(); err != nil {
+    t.Errorf("Save produced error after a good Load: %s", err)
+  }
+}
+
+func TestUtilityConfigValidate(t *testing.T) {
+  c := DefaultUtilityConfig()
+  if err := c.Validate(); err != nil {
+    t.Errorf("Default config should be valid: %s", err)
+  }
+  c.SampleThreshold = 0
+  if err := c.Validate(); err == nil {
+    t.Errorf("SampleThreshold 0 should not be valid")
+  }
+  u := NewUtilityWithConfig(UtilityConfig{10, false, false, 20, "/tmp/frank-test.sav"})
+  if u.Config.SampleThreshold != 20 {
+    t.Errorf("Invalid SampleThreshold : %d, should be 20", u.Config.SampleThreshold)
+  }
+}
+
+func TestUtilityDeleteMeter(t *testing.T) {
+  u := NewUtility()
+  u.NewMeter("TestCluster", "localhost", "Space1.Test1", "ReadHistory")
+  u.NewMeter("TestCluster", "localhost", "Space1.Test1", "WriteHistory")
+  if err := u.DeleteMeter("TestCluster", "localhost", "Space1.Test1", "ReadHistory"); err != nil {
+    t.Errorf("DeleteMeter produced error: %s", err)
+  }
+  if u.SizeMeters() != 1 {
+    t.Errorf("Invalid Meter Size : %d, should be 1", u.SizeMeters())
+  }
+  if err := u.DeleteMeter("TestCluster", "localhost", "Space1.Test1", "ReadHistory"); err == nil {
+    t.Errorf("Deleting a missing meter should produce an error")
+  }
+  u.DeleteMeter("TestCluster", "localhost", "Space1.Test1", "WriteHistory")
+  if u.SizeClusters() != 0 {
+    t.Errorf("Empty cluster not removed : %d clusters, should be 0", u.SizeClusters())
+  }
+}
+
+func TestUtilityMerge(t *testing.T) {
+  var a, b bytes.Buffer
+  for x, buf := range []*bytes.Buffer{&a, &b} {
+    u := NewUtility()
+    u.NewMeter("Test Cluster", "host" + fmt.Sprint(x), "system.Test1", "WriteLatency")
+    u.NewMeter("Test Cluster", "shared", "system.Test1", "WriteLatency")
+    for _, ts := range []int64{1410000000000, 1410000005000 + int64(x) * 5000} {
+      s := Sample{ts, []float64{float64(x + 1), 1}}
+      u.AddSample("Test Cluster", "host" + fmt.Sprint(x), "system.Test1", "WriteLatency", s)
+      u.AddSample("Test Cluster", "shared", "system.Test1", "WriteLatency", s)
+    }
+    enc := gob.NewEncoder(buf)
+    for _, m := range u.meters() {
+      enc.Encode(m)
+    }
+  }
+
+  for _, tc := range []struct {
+    policy string
+    first float64
+  }{{"replace", 1}, {"keep", 2}, {"max", 2}} {
+    policy, err := ParseMergePolicy(tc.policy)
+    if err != nil {
+      t.Fatalf("ParseMergePolicy(%s) produced error: %s", tc.policy, err)
+    }
+    u := NewUtility()
+    u.Merge(bytes.NewReader(b.Bytes()), MergeReplace)
+    samples, dups, err := u.Merge(bytes.NewReader(a.Bytes()), policy)
+    if err != nil || samples != 4 || dups != 1 {
+      t.Errorf("%s: Invalid merge : %d samples, %d duplicates, %v", tc.policy, samples, dups, err)
+    }
+    if u.SizeMeters() != 3 {
+      t.Errorf("%s: Invalid Meter Size : %d, should be 3", tc.policy, u.SizeMeters())
+    }
+    m, _ := u.GetMeter("Test Cluster", "shared", "system.Test1", "WriteLatency")
+    if raw, _ := m.Raw(); len(raw) != 3 || raw[0].Data[0] != tc.first {
+      t.Errorf("%s: Invalid merged samples : %v", tc.policy, raw)
+    }
+  }
+  if _, err := ParseMergePolicy("newest"); err == nil {
+    t.Errorf("Expected an error for an unknown merge policy")
+  }
+}